@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pavletto/altituder/cmd/ddm"
+)
+
+func TestOpenBackendTileLayer(t *testing.T) {
+	dir := t.TempDir()
+	store, err := ddm.NewStore(ddm.StoreConfig{CacheDir: dir, DefaultZoom: 10, HeightFactor: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := openBackend(store, "ddm", ""); err != nil || b != ddm.Backend(store) {
+		t.Fatalf("bare ddm must be the shared store: %v, %v", b, err)
+	}
+
+	const rgb = "https://api.example.com/{z}/{x}/{y}.png"
+	b, err := openBackend(store, "ddm", "terrain-rgb:"+rgb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := b.(*ddm.Store).Config()
+	if b == ddm.Backend(store) || cfg.Format != ddm.FormatTerrainRGB || cfg.URLTemplate != rgb || !cfg.PermitDownload {
+		t.Errorf("terrain-rgb layer: %+v", cfg)
+	}
+	if !strings.HasPrefix(cfg.CacheDir, filepath.Join(dir, "layers")+string(filepath.Separator)) {
+		t.Errorf("layer cache dir %q shares the main cache", cfg.CacheDir)
+	}
+
+	// без формата — формат основного источника, свой каталог кэша
+	b2, err := openBackend(store, "ddm", "https://b.example.com/{z}/{y}/{x}.ddm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg2 := b2.(*ddm.Store).Config(); cfg2.Format != ddm.FormatDDM || cfg2.CacheDir == cfg.CacheDir {
+		t.Errorf("ddm layer: %+v", cfg2)
+	}
+
+	for _, arg := range []string{"./tiles", "terrarium:https://x/tiles.png"} {
+		if _, err := openBackend(store, "ddm", arg); err == nil {
+			t.Errorf("%q: expected error", arg)
+		}
+	}
+}
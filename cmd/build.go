@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/ddm"
+	"github.com/spf13/cobra"
+)
+
+// buildCmd конвертирует HGT/GeoTIFF в пирамиду {z}/{y}/{x}.ddm для собственного тайл-сервера
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Convert a DEM (HGT dir or GeoTIFF) into a z/y/x .ddm tile pyramid",
+	Long: `Resamples the source DEM into Web Mercator tiles and writes
+{out}/{z}/{y}/{x}.ddm in the same layout the server cache uses.
+
+  build --src ./srtm --bbox 24,55,26,57 --min-z 8 --max-z 12 --out ./cache
+  build --src survey.tif --max-z 15 --grid 129`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := cmd.Flags()
+		srcPath, _ := f.GetString("src")
+		kind, _ := f.GetString("type")
+		bboxStr, _ := f.GetString("bbox")
+
+		src, bounds, err := openBuildSource(srcPath, kind)
+		if err != nil {
+			return err
+		}
+		if bboxStr != "" {
+			b, err := ddm.ParseBBox(bboxStr)
+			if err != nil {
+				return err
+			}
+			bounds = &b
+		}
+		if bounds == nil {
+			return fmt.Errorf("--bbox required for %s", srcPath)
+		}
+
+		var cfg ddm.BuildConfig
+		cfg.OutDir, _ = f.GetString("out")
+		cfg.MinZoom, _ = f.GetInt("min-z")
+		cfg.MaxZoom, _ = f.GetInt("max-z")
+		cfg.GridSize, _ = f.GetInt("grid")
+		cfg.NoData, _ = f.GetFloat32("nodata")
+		cfg.Overwrite, _ = f.GetBool("overwrite")
+		cfg.Workers, _ = f.GetInt("workers")
+
+		var mu sync.Mutex
+		last := time.Now()
+		cfg.Progress = func(done, total int) {
+			// вызывается из воркеров — печатаем не чаще раза в секунду
+			mu.Lock()
+			defer mu.Unlock()
+			if done == total || time.Since(last) > time.Second {
+				last = time.Now()
+				log.Printf("%d/%d tiles", done, total)
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		start := time.Now()
+		st, err := ddm.BuildTiles(ctx, src, *bounds, cfg)
+		log.Printf("written=%d empty=%d existed=%d total=%d in %s", st.Written, st.Empty, st.Existed, st.Total, time.Since(start).Round(time.Millisecond))
+		return err
+	},
+}
+
+// openBuildSource открывает источник; тип по умолчанию — по пути (каталог → hgt, .tif → geotiff).
+// Для GeoTIFF охват берётся из самого растра.
+func openBuildSource(path, kind string) (ddm.Backend, *ddm.BBox, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("--src required")
+	}
+	if kind == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".tif", ".tiff":
+			kind = "geotiff"
+		default:
+			kind = "hgt"
+		}
+	}
+	switch kind {
+	case "hgt":
+		src, err := ddm.NewHGTStore(path, 16, 0)
+		return src, nil, err
+	case "geotiff":
+		src, err := ddm.OpenGeoTIFF(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		s, w, n, e := src.Bounds()
+		return src, &ddm.BBox{South: s, West: w, North: n, East: e}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown source type %q (hgt|geotiff)", kind)
+	}
+}
+
+func init() {
+	f := buildCmd.Flags()
+	f.String("src", "", "source: directory with .hgt/.hgt.zip or a GeoTIFF file")
+	f.String("type", "", "source type hgt|geotiff (default: by --src)")
+	f.String("bbox", "", "south,west,north,east in degrees (default: GeoTIFF bounds)")
+	f.String("out", "./cache", "output directory")
+	f.Int("min-z", 0, "min zoom")
+	f.Int("max-z", 14, "max zoom")
+	f.Int("grid", ddm.DefaultBuildGrid, "nodes per tile side")
+	f.Float32("nodata", -32768, "value written where the source has no data (pass the same in DDM_NODATA_CSV)")
+	f.Bool("overwrite", false, "rewrite existing tiles")
+	f.Int("workers", 0, "parallel tiles (default: NumCPU)")
+	rootCmd.AddCommand(buildCmd)
+}
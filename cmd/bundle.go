@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pavletto/altituder/cmd/ddm"
+	"github.com/spf13/cobra"
+)
+
+// bundleCmd — перенос кэша одним файлом: tar с index.json, читается и напрямую (DDM_BUNDLE)
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Export/import the tile cache as a single offline bundle file",
+	Long: `A bundle is an uncompressed tar: index.json (format, zooms, tile offsets)
+followed by the tiles in the cache layout {z}/{y}/{x}.{ddm|png}. The server
+reads it directly with DDM_BUNDLE=kit.tar (after the disk cache) or as
+ELEV_BACKEND=bundle BUNDLE_PATH=kit.tar.
+
+  bundle export --out kit.tar --bbox 24,55,26,57 --max-z 14
+  bundle import kit.tar
+  bundle info kit.tar`,
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Pack cached tiles (optionally an area and zoom range) into a bundle",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := cmd.Flags()
+		out, _ := f.GetString("out")
+		if out == "" {
+			return fmt.Errorf("--out required")
+		}
+		area, err := seedArea(cmd)
+		if err != nil {
+			return err
+		}
+		var opt ddm.BundleOptions
+		opt.Area = area
+		opt.MinZoom, _ = f.GetInt("min-z")
+		opt.MaxZoom, _ = f.GetInt("max-z")
+		format, _ := f.GetString("format")
+		if opt.Format, err = ddm.ParseTileFormat(format); err != nil {
+			return err
+		}
+		idx, err := ddm.ExportBundle(cacheDirFlag(cmd), out, opt)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %d %s tiles, z%d..%d\n", out, len(idx.Tiles), idx.Format, idx.MinZoom, idx.MaxZoom)
+		return nil
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import BUNDLE",
+	Short: "Unpack a bundle into the cache directory",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		overwrite, _ := cmd.Flags().GetBool("overwrite")
+		st, err := ddm.ImportBundle(args[0], cacheDirFlag(cmd), overwrite)
+		fmt.Fprintf(cmd.OutOrStdout(), "imported %d, existed %d, corrupt %d\n", st.Imported, st.Existed, st.Corrupt)
+		return err
+	},
+}
+
+var bundleInfoCmd = &cobra.Command{
+	Use:   "info BUNDLE",
+	Short: "Show bundle format, coverage and tiles per zoom",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := ddm.OpenBundle(args[0])
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+		idx := b.Index
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "format:  %s\n", idx.Format)
+		fmt.Fprintf(out, "created: %s\n", idx.Created.Format("2006-01-02 15:04:05Z"))
+		fmt.Fprintf(out, "tiles:   %d\n", len(idx.Tiles))
+		if idx.Bounds != nil {
+			fmt.Fprintf(out, "bounds:  %.5f,%.5f,%.5f,%.5f\n", idx.Bounds.South, idx.Bounds.West, idx.Bounds.North, idx.Bounds.East)
+		}
+		perZ := make(map[int]int)
+		for k := range idx.Tiles {
+			zs, _, _ := strings.Cut(k, "/")
+			z, _ := strconv.Atoi(zs)
+			perZ[z]++
+		}
+		for z := idx.MinZoom; z <= idx.MaxZoom; z++ {
+			if perZ[z] > 0 {
+				fmt.Fprintf(out, "  z%-2d %d\n", z, perZ[z])
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	bundleCmd.PersistentFlags().String("dir", getenv("DDM_CACHE_DIR", "./cache"), "cache directory")
+	f := bundleExportCmd.Flags()
+	f.String("out", "", "bundle file to write")
+	f.String("format", getenv("DDM_FORMAT", "ddm"), "tiles to pack: ddm|terrain-rgb|terrarium")
+	f.Int("min-z", 0, "min zoom")
+	f.Int("max-z", 0, "max zoom (0 = all)")
+	addAreaFlags(bundleExportCmd)
+	bundleImportCmd.Flags().Bool("overwrite", false, "replace tiles already in the cache")
+	bundleCmd.AddCommand(bundleExportCmd, bundleImportCmd, bundleInfoCmd)
+	rootCmd.AddCommand(bundleCmd)
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/ddm"
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd — обслуживание дискового кэша тайлов {dir}/{z}/{y}/{x}.{ddm|png}
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and maintain the on-disk tile cache",
+	Long: `Maintenance of the tile cache the server fills (DDM_CACHE_DIR).
+
+  cache stats
+  cache prune --max-size 2G --max-age 720h
+  cache verify --fix
+  cache clear --yes`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show tile count, size and per-zoom breakdown",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := cacheDirFlag(cmd)
+		st, err := ddm.ScanCache(dir)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "dir:    %s\n", dir)
+		fmt.Fprintf(out, "tiles:  %d\n", st.Tiles)
+		fmt.Fprintf(out, "size:   %s\n", formatSize(st.Bytes))
+		if st.Tiles > 0 {
+			fmt.Fprintf(out, "oldest: %s\n", st.Oldest.Format(time.RFC3339))
+			fmt.Fprintf(out, "newest: %s\n", st.Newest.Format(time.RFC3339))
+		}
+		if st.Temp > 0 || st.Orphaned > 0 {
+			fmt.Fprintf(out, "leftovers: %d tmp, %d orphaned .meta (removed by prune)\n", st.Temp, st.Orphaned)
+		}
+		zs := make([]int, 0, len(st.ByZoom))
+		for z := range st.ByZoom {
+			zs = append(zs, z)
+		}
+		sort.Ints(zs)
+		for _, z := range zs {
+			fmt.Fprintf(out, "  z%-2d %d\n", z, st.ByZoom[z])
+		}
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Evict least recently used tiles down to --max-size and/or older than --max-age",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := cmd.Flags()
+		sizeStr, _ := f.GetString("max-size")
+		maxAge, _ := f.GetDuration("max-age")
+		maxBytes, err := parseSize(sizeStr)
+		if err != nil {
+			return err
+		}
+		if maxBytes <= 0 && maxAge <= 0 {
+			return fmt.Errorf("--max-size or --max-age required")
+		}
+		res, err := ddm.PruneCache(cacheDirFlag(cmd), maxBytes, maxAge)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "removed %d tiles, freed %s, %s left\n", res.Removed, formatSize(res.Freed), formatSize(res.Remaining))
+		return nil
+	},
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Decode every tile and report (or with --fix remove) corrupt ones",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fix, _ := cmd.Flags().GetBool("fix")
+		bad, checked, err := ddm.VerifyCache(cacheDirFlag(cmd), fix)
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		for _, p := range bad {
+			fmt.Fprintln(out, "corrupt:", p)
+		}
+		fmt.Fprintf(out, "checked %d tiles, %d corrupt", checked, len(bad))
+		if fix && len(bad) > 0 {
+			fmt.Fprint(out, " (removed)")
+		}
+		fmt.Fprintln(out)
+		if len(bad) > 0 && !fix {
+			return fmt.Errorf("%d corrupt tiles, rerun with --fix to remove", len(bad))
+		}
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached tiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			return fmt.Errorf("refusing to clear %s without --yes", cacheDirFlag(cmd))
+		}
+		n, err := ddm.ClearCache(cacheDirFlag(cmd))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "removed %d tiles\n", n)
+		return nil
+	},
+}
+
+func cacheDirFlag(cmd *cobra.Command) string {
+	dir, _ := cmd.Flags().GetString("dir")
+	return dir
+}
+
+// parseSize понимает 1048576, 512K, 300M, 2G (двоичные единицы).
+func parseSize(s string) (int64, error) {
+	orig := s
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	if s == "" {
+		return 0, fmt.Errorf("invalid size %q", orig)
+	}
+	shift := 0
+	switch s[len(s)-1] {
+	case 'K':
+		shift = 10
+	case 'M':
+		shift = 20
+	case 'G':
+		shift = 30
+	case 'T':
+		shift = 40
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(v >= 0) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("bad size %q (e.g. 500M, 2G)", orig)
+	}
+	return int64(v * float64(int64(1)<<shift)), nil
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, exp := float64(n), 0
+	for v >= unit && exp < 4 {
+		v /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, "KMGT"[exp-1])
+}
+
+func init() {
+	cacheCmd.PersistentFlags().String("dir", getenv("DDM_CACHE_DIR", "./cache"), "cache directory")
+	cachePruneCmd.Flags().String("max-size", "", "target cache size, e.g. 500M, 2G")
+	cachePruneCmd.Flags().Duration("max-age", 0, "remove tiles not read for longer, e.g. 720h")
+	cacheVerifyCmd.Flags().Bool("fix", false, "remove corrupt tiles")
+	cacheClearCmd.Flags().Bool("yes", false, "confirm")
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheVerifyCmd, cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
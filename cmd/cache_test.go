@@ -0,0 +1,25 @@
+package cmd
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"":        0,
+		"0":       0,
+		"1048576": 1 << 20,
+		"512K":    512 << 10,
+		"300mb":   300 << 20,
+		"2GiB":    2 << 30,
+		"1.5G":    3 << 29,
+		" 1T ":    1 << 40,
+	} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"B", "iB", "KiB", "G", "-1M", "abc", "NaN", "Inf", "12X"} {
+		if got, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) = %d, want error", in, got)
+		}
+	}
+}
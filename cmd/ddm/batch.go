@@ -0,0 +1,186 @@
+package ddm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxBatchPoints = 10000
+	maxPointsBody  = 8 << 20 // POST-тело со списком точек
+)
+
+type PointResult struct {
+	Height float64
+	Meta   Meta
+	Err    error
+}
+
+// HeightBatch возвращает высоты в порядке входных точек. Точки группируются
+// по тайлам, так что каждый тайл достаётся из кэша/диска/сети один раз за батч.
+// Ошибка по одной точке (nodata, нет тайла) не роняет весь батч.
+func (s *Store) HeightBatch(ctx context.Context, pts []LatLon, z int) []PointResult {
+	if z <= 0 {
+		z = s.cfg.DefaultZoom
+	}
+	nz := s.nativeZoom(z)
+	type tileKey struct{ x, y int }
+
+	out := make([]PointResult, len(pts))
+	groups := make(map[tileKey][]int)
+	var order []tileKey
+	for i, p := range pts {
+		if p.Lat < minLat || p.Lat > maxLat || p.Lon < -180 || p.Lon > 180 {
+			out[i].Err = fmt.Errorf("coordinates out of range")
+			continue
+		}
+		x, y := tileXYZ(p.Lat, wrapLon(p.Lon), nz)
+		k := tileKey{x, y}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+
+	for _, k := range order {
+		idx := groups[k]
+		if err := ctx.Err(); err != nil {
+			for _, i := range idx {
+				out[i].Meta = Meta{Z: nz, X: k.x, Y: k.y, RequestedZ: z}
+				out[i].Err = err
+			}
+			continue
+		}
+		// все точки группы лежат в одном тайле, а значит и в одном его предке
+		td, meta, err := s.tileOrParent(ctx, nz, k.x, k.y)
+		meta.RequestedZ = z
+		m := interpFrom(ctx, s.cfg.Interp)
+		var ts *tileSampler
+		if err == nil {
+			ts = s.newSampler(ctx, td, meta.Z, meta.X, meta.Y) // соседи грузятся один раз на группу
+		}
+		for _, i := range idx {
+			out[i].Meta = meta
+			if err != nil {
+				out[i].Err = err
+				continue
+			}
+			lat, lon := pts[i].Lat, wrapLon(pts[i].Lon)
+			h, used, ok := ts.height(lat, lon, m)
+			out[i].Meta.Interp = used
+			out[i].Meta.Filled = ok && ts.filledNear(lat, lon)
+			if !ok {
+				out[i].Err = ErrNoData
+				continue
+			}
+			out[i].Height = h
+		}
+	}
+	return out
+}
+
+// HandleHeightBatch: POST JSON-массив {lat,lon}, {"points":[...],"z":N}
+// либо GeoJSON MultiPoint/LineString (можно внутри Feature).
+func (s *Server) HandleHeightBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPointsBody))
+	if err != nil {
+		http.Error(w, "read body: "+err.Error(), bodyErrorStatus(err))
+		return
+	}
+	pts, z, err := parseBatchPoints(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(pts) > maxBatchPoints {
+		http.Error(w, fmt.Sprintf("too many points: %d > %d", len(pts), maxBatchPoints), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if zq := r.URL.Query().Get("z"); zq != "" {
+		if zi, err := strconv.Atoi(zq); err == nil {
+			z = zi
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	if iq := r.URL.Query().Get("interp"); iq != "" {
+		m, err := ParseInterp(iq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx = WithInterp(ctx, m)
+	}
+
+	res := s.backend().HeightBatch(ctx, pts, z)
+	items := make([]map[string]any, len(res))
+	for i, pr := range res {
+		item := map[string]any{
+			"lat": pts[i].Lat,
+			"lon": pts[i].Lon,
+		}
+		if pr.Err != nil {
+			item["height"] = nil
+			item["error"] = pr.Err.Error()
+		} else {
+			item["height"] = pr.Height
+			item["tile"] = map[string]any{"z": pr.Meta.Z, "x": pr.Meta.X, "y": pr.Meta.Y}
+			item["tile_source"] = pr.Meta.Source
+			item["grid_size"] = pr.Meta.GridSize
+			if pr.Meta.Name != "" {
+				item["tile_name"] = pr.Meta.Name
+			}
+			if pr.Meta.Interp != "" {
+				item["interp"] = pr.Meta.Interp
+			}
+			item["filled"] = pr.Meta.Filled
+		}
+		items[i] = item
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"count":   len(items),
+		"results": items,
+	})
+}
+
+func parseBatchPoints(raw []byte) ([]LatLon, int, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, 0, fmt.Errorf("empty body")
+	}
+	if raw[0] == '[' {
+		var pts []LatLon
+		if err := json.Unmarshal(raw, &pts); err != nil {
+			return nil, 0, fmt.Errorf("invalid json body: %w", err)
+		}
+		return pts, 0, nil
+	}
+
+	var obj struct {
+		Type   string   `json:"type"`
+		Points []LatLon `json:"points"`
+		Z      int      `json:"z"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, 0, fmt.Errorf("invalid json body: %w", err)
+	}
+	if obj.Type != "" {
+		pts, err := parseGeoJSONPoints(raw)
+		return pts, obj.Z, err
+	}
+	return obj.Points, obj.Z, nil
+}
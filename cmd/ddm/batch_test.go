@@ -0,0 +1,23 @@
+package ddm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleHeightBatchBodyLimit(t *testing.T) {
+	srv := &Server{Source: &stubBackend{h: 50}}
+	body := `[{"lat":25.5,"lon":55}` + strings.Repeat(" ", maxPointsBody) + `]`
+	w := httptest.NewRecorder()
+	srv.HandleHeightBatch(w, httptest.NewRequest(http.MethodPost, "/height/batch", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("huge body: code=%d, want 413", w.Code)
+	}
+	w = httptest.NewRecorder()
+	srv.HandleHeightBatch(w, httptest.NewRequest(http.MethodPost, "/height/batch", strings.NewReader(`[{"lat":25.5,"lon":55}]`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("small body: code=%d %s", w.Code, w.Body)
+	}
+}
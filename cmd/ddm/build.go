@@ -0,0 +1,178 @@
+package ddm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultBuildGrid = 65
+
+type BuildConfig struct {
+	OutDir           string
+	MinZoom, MaxZoom int
+	GridSize         int     // узлов по стороне, узлы на краях тайла (как читает parseDDM)
+	NoData           float32 // пишется там, где у источника нет данных
+	Overwrite        bool    // иначе существующие тайлы пропускаются (можно докачивать)
+	Workers          int
+
+	// Progress вызывается после каждого тайла; должен быть потокобезопасным.
+	Progress func(done, total int)
+}
+
+type BuildStats struct {
+	Total   int // тайлов в диапазоне
+	Written int
+	Empty   int // у источника ни одного значения — файл не создаём
+	Existed int
+}
+
+type tileJob struct{ z, x, y int }
+
+// BuildTiles пересэмплирует источник в тайлы Web Mercator {z}/{y}/{x}.ddm
+// в пределах bbox для всех зумов MinZoom..MaxZoom.
+func BuildTiles(ctx context.Context, src Backend, bbox BBox, cfg BuildConfig) (BuildStats, error) {
+	if cfg.OutDir == "" {
+		return BuildStats{}, fmt.Errorf("OutDir required")
+	}
+	if cfg.MinZoom < 0 || cfg.MaxZoom > 22 || cfg.MinZoom > cfg.MaxZoom {
+		return BuildStats{}, fmt.Errorf("bad zoom range %d..%d", cfg.MinZoom, cfg.MaxZoom)
+	}
+	if cfg.GridSize == 0 {
+		cfg.GridSize = DefaultBuildGrid
+	}
+	if cfg.GridSize < 2 || cfg.GridSize > 4097 {
+		return BuildStats{}, fmt.Errorf("bad grid size %d", cfg.GridSize)
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+
+	// задания не копим: на больших зумах их миллионы, раздаём прямо из перебора
+	total := 0
+	for z := cfg.MinZoom; z <= cfg.MaxZoom; z++ {
+		x0, y0, x1, y1 := tileRange(bbox, z)
+		total += (x1 - x0 + 1) * (y1 - y0 + 1)
+	}
+
+	var (
+		st       = BuildStats{Total: total}
+		mu       sync.Mutex
+		firstErr error
+		done     atomic.Int64
+		wg       sync.WaitGroup
+		ch       = make(chan tileJob)
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range ch {
+				res, err := buildTile(ctx, src, j, cfg)
+				mu.Lock()
+				switch {
+				case err != nil:
+					if firstErr == nil {
+						firstErr = fmt.Errorf("tile %d/%d/%d: %w", j.z, j.y, j.x, err)
+						cancel()
+					}
+				case res == buildWritten:
+					st.Written++
+				case res == buildEmpty:
+					st.Empty++
+				case res == buildExisted:
+					st.Existed++
+				}
+				mu.Unlock()
+				if cfg.Progress != nil {
+					cfg.Progress(int(done.Add(1)), total)
+				}
+			}
+		}()
+	}
+feed:
+	for z := cfg.MinZoom; z <= cfg.MaxZoom; z++ {
+		x0, y0, x1, y1 := tileRange(bbox, z)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				select {
+				case ch <- tileJob{z, x, y}:
+				case <-ctx.Done():
+					break feed
+				}
+			}
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	if firstErr != nil {
+		return st, firstErr
+	}
+	return st, ctx.Err()
+}
+
+const (
+	buildWritten = iota
+	buildEmpty
+	buildExisted
+)
+
+func buildTile(ctx context.Context, src Backend, j tileJob, cfg BuildConfig) (int, error) {
+	path := TilePath(cfg.OutDir, FormatDDM, j.z, j.x, j.y)
+	if !cfg.Overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return buildExisted, nil
+		}
+	}
+
+	gs := cfg.GridSize
+	pts := make([]LatLon, gs*gs)
+	for i := 0; i < gs; i++ {
+		for k := 0; k < gs; k++ {
+			lat, lon := tileFracToLatLon(j.z, j.x, j.y, float64(k)/float64(gs-1), float64(i)/float64(gs-1))
+			pts[i*gs+k] = LatLon{Lat: lat, Lon: lon}
+		}
+	}
+
+	vals := make([]float32, len(pts))
+	valid := 0
+	for i, r := range src.HeightBatch(ctx, pts, j.z) {
+		if r.Err != nil {
+			if !fallThrough(r.Err) {
+				return 0, r.Err
+			}
+			vals[i] = cfg.NoData
+			continue
+		}
+		vals[i] = float32(r.Height)
+		valid++
+	}
+	if valid == 0 {
+		return buildEmpty, nil
+	}
+
+	raw, err := EncodeDDM(vals)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(path, raw); err != nil {
+		return 0, err
+	}
+	return buildWritten, nil
+}
+
+// tileRange — индексы тайлов зума z, пересекающих bbox (включительно).
+func tileRange(b BBox, z int) (x0, y0, x1, y1 int) {
+	x0, y0 = tileXYZ(b.North, b.West, z)
+	x1, y1 = tileXYZ(b.South, b.East, z)
+	last := 1<<z - 1
+	clamp := func(v int) int { return min(max(v, 0), last) }
+	return clamp(x0), clamp(y0), clamp(x1), clamp(y1)
+}
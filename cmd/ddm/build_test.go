@@ -0,0 +1,94 @@
+package ddm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"testing"
+)
+
+// rampBackend — h = 1000*lon внутри охвата, снаружи нет данных.
+type rampBackend struct{ bbox BBox }
+
+func (b rampBackend) Height(_ context.Context, lat, lon float64, _ int) (float64, Meta, error) {
+	if !b.bbox.Contains(lat, lon) {
+		return 0, Meta{}, ErrTileNotFound
+	}
+	return 1000 * lon, Meta{Source: "ramp"}, nil
+}
+
+func (b rampBackend) HeightBatch(ctx context.Context, pts []LatLon, z int) []PointResult {
+	out := make([]PointResult, len(pts))
+	for i, p := range pts {
+		out[i].Height, out[i].Meta, out[i].Err = b.Height(ctx, p.Lat, p.Lon, z)
+	}
+	return out
+}
+
+func TestBuildTilesRoundTrip(t *testing.T) {
+	const z = 10
+	src := rampBackend{bbox: BBox{South: 24.5, West: 55.5, North: 25.5, East: 56.5}}
+	// охват сборки шире источника: крайние тайлы частично или полностью пустые
+	area := BBox{South: 24.9, West: 55.9, North: 25.1, East: 57.5}
+	cfg := BuildConfig{OutDir: t.TempDir(), MinZoom: z, MaxZoom: z, GridSize: 17, NoData: -32768, Workers: 3}
+
+	st, err := BuildTiles(context.Background(), src, area, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x0, y0, x1, y1 := tileRange(area, z)
+	if st.Total != (x1-x0+1)*(y1-y0+1) || st.Written == 0 || st.Empty == 0 || st.Written+st.Empty != st.Total {
+		t.Fatalf("stats %+v", st)
+	}
+
+	s, err := NewStore(StoreConfig{CacheDir: cfg.OutDir, DefaultZoom: z, HeightFactor: 1, NoDataValues: []float32{cfg.NoData}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []LatLon{{25.0, 56.0}, {25.05, 56.2345}, {24.95, 56.49}} {
+		h, meta, err := s.Height(context.Background(), p.Lat, p.Lon, z)
+		// float32 на ~56000 м: точность ~4 мм
+		if err != nil || math.Abs(h-1000*p.Lon) > 0.01 {
+			t.Errorf("%v: h=%v want %v err=%v", p, h, 1000*p.Lon, err)
+		}
+		if meta.GridSize != cfg.GridSize || meta.Source == "download" {
+			t.Errorf("%v: meta %+v", p, meta)
+		}
+	}
+	x, y := tileXYZ(25, 57.4, z)
+	if _, err := os.Stat(TilePath(cfg.OutDir, FormatDDM, z, x, y)); !os.IsNotExist(err) {
+		t.Errorf("empty tile written: %v", err)
+	}
+
+	// повторный запуск не переписывает готовые тайлы
+	st2, err := BuildTiles(context.Background(), src, area, cfg)
+	if err != nil || st2.Existed != st.Written || st2.Written != 0 {
+		t.Errorf("rerun: %+v err=%v", st2, err)
+	}
+}
+
+func TestBuildTilesStreamsJobs(t *testing.T) {
+	// весь мир до z16 — миллиарды тайлов: задания должны раздаваться по ходу перебора
+	world := BBox{South: minLat, West: -180, North: maxLat, East: 180}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last int
+	cfg := BuildConfig{
+		OutDir: t.TempDir(), MinZoom: 0, MaxZoom: 16, GridSize: 2, Workers: 2,
+		Progress: func(done, total int) {
+			if done == 100 {
+				last = total
+				cancel()
+			}
+		},
+	}
+	st, err := BuildTiles(ctx, rampBackend{}, world, cfg)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v", err)
+	}
+	want := (1<<(2*17) - 1) / 3 // Σ 4^z, z=0..16
+	if st.Total != want || last != want || st.Written+st.Empty < 100 {
+		t.Errorf("stats %+v, progress total %d, want %d", st, last, want)
+	}
+}
@@ -0,0 +1,313 @@
+package ddm
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Бандл — один несжатый tar для полевого комплекта вместо тысяч мелких файлов:
+//
+//	index.json          — первая запись: формат, зумы и смещения всех тайлов
+//	{z}/{y}/{x}.{ext}   — тайлы в раскладке кэша (tar -xf bundle.tar -C cache тоже работает)
+//
+// Смещения в индексе позволяют читать тайл одним ReadAt без разбора tar.
+
+const (
+	bundleIndexName = "index.json"
+	bundleVersion   = 1
+	tarBlock        = 512
+	maxBundleIndex  = 256 << 20 // ~4 млн тайлов; больше — битый или чужой файл
+)
+
+type BundleIndex struct {
+	Version int        `json:"version"`
+	Format  TileFormat `json:"format"`
+	Created time.Time  `json:"created"`
+	MinZoom int        `json:"min_zoom"`
+	MaxZoom int        `json:"max_zoom"`
+	Bounds  *BBox      `json:"bounds,omitempty"` // охват тайлов
+
+	Tiles map[string][2]int64 `json:"tiles"` // "z/y/x" → [смещение данных, размер]
+}
+
+// Bundle — открытый на чтение бандл.
+type Bundle struct {
+	Index BundleIndex
+	f     *os.File
+}
+
+func OpenBundle(path string) (*Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := readBundleIndex(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("bundle %s: %w", path, err)
+	}
+	return &Bundle{Index: idx, f: f}, nil
+}
+
+func readBundleIndex(f *os.File) (BundleIndex, error) {
+	var idx BundleIndex
+	fi, err := f.Stat()
+	if err != nil {
+		return idx, err
+	}
+	hdr, err := tar.NewReader(f).Next()
+	if err != nil {
+		return idx, err
+	}
+	if hdr.Name != bundleIndexName {
+		return idx, fmt.Errorf("first entry %q, want %s", hdr.Name, bundleIndexName)
+	}
+	// размер из заголовка не верим до выделения памяти
+	if hdr.Size < 0 || hdr.Size > fi.Size()-tarBlock || hdr.Size > maxBundleIndex {
+		return idx, fmt.Errorf("index size %d out of range (file %d bytes)", hdr.Size, fi.Size())
+	}
+	// tar.Reader не буферизует: данные индекса начинаются сразу за заголовком
+	raw := make([]byte, hdr.Size)
+	if _, err := f.ReadAt(raw, tarBlock); err != nil {
+		return idx, err
+	}
+	if err := json.Unmarshal(raw, &idx); err != nil {
+		return idx, err
+	}
+	if idx.Version != bundleVersion {
+		return idx, fmt.Errorf("unsupported version %d", idx.Version)
+	}
+	if idx.Format, err = ParseTileFormat(string(idx.Format)); err != nil {
+		return idx, err
+	}
+	for k, e := range idx.Tiles {
+		if e[0] < tarBlock || e[1] < 0 || e[0]+e[1] > fi.Size() {
+			return idx, fmt.Errorf("tile %s outside the file", k)
+		}
+	}
+	return idx, nil
+}
+
+func (b *Bundle) Close() error { return b.f.Close() }
+
+// ReadTile возвращает сырые байты тайла; нет в бандле — ErrTileNotFound.
+func (b *Bundle) ReadTile(z, x, y int) ([]byte, error) {
+	e, ok := b.Index.Tiles[fmt.Sprintf("%d/%d/%d", z, y, x)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d/%d/%d not in bundle", ErrTileNotFound, z, y, x)
+	}
+	raw := make([]byte, e[1])
+	if _, err := b.f.ReadAt(raw, e[0]); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+type BundleOptions struct {
+	Format           TileFormat // какие тайлы брать из кэша, по умолчанию ddm
+	MinZoom, MaxZoom int        // MaxZoom 0 — все зумы
+	Area             Area       // nil — весь кэш
+}
+
+// ExportBundle собирает тайлы из каталога кэша в бандл out (пишется во временный
+// файл и переименовывается). Возвращает индекс записанного бандла.
+func ExportBundle(dir, out string, opt BundleOptions) (BundleIndex, error) {
+	format, err := ParseTileFormat(string(opt.Format))
+	if err != nil {
+		return BundleIndex{}, err
+	}
+	sc, err := scanCache(dir)
+	if err != nil {
+		return BundleIndex{}, err
+	}
+
+	type entry struct {
+		key, name, path string
+		size            int64
+	}
+	var entries []entry
+	idx := BundleIndex{Version: bundleVersion, Format: format, Created: time.Now().UTC().Truncate(time.Second), MinZoom: -1}
+	for _, f := range sc.tiles {
+		rel, _ := filepath.Rel(dir, f.path)
+		name := filepath.ToSlash(rel)
+		z, x, y, ok := parseCacheName(name, format.ext())
+		if !ok || z < opt.MinZoom || (opt.MaxZoom > 0 && z > opt.MaxZoom) {
+			continue
+		}
+		tb := tileBounds(z, x, y)
+		if opt.Area != nil && !(opt.Area.Bounds().intersects(tb) && opt.Area.intersects(tb)) {
+			continue
+		}
+		fi, err := os.Stat(f.path) // размер без сайдкара
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{fmt.Sprintf("%d/%d/%d", z, y, x), name, f.path, fi.Size()})
+		if idx.MinZoom < 0 || z < idx.MinZoom {
+			idx.MinZoom = z
+		}
+		idx.MaxZoom = max(idx.MaxZoom, z)
+		if idx.Bounds == nil {
+			idx.Bounds = &tb
+		} else {
+			*idx.Bounds = idx.Bounds.union(tb)
+		}
+	}
+	if len(entries) == 0 {
+		return BundleIndex{}, fmt.Errorf("no %s tiles to export in %s", format, dir)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	// смещения зависят от размера самого индекса — пересчитываем, пока
+	// число блоков под индекс не перестанет меняться (растёт монотонно)
+	blocks := func(n int64) int64 { return (n + tarBlock - 1) / tarBlock * tarBlock }
+	var idxRaw []byte
+	for pad := int64(0); ; {
+		idx.Tiles = make(map[string][2]int64, len(entries))
+		off := tarBlock + pad
+		for _, e := range entries {
+			idx.Tiles[e.key] = [2]int64{off + tarBlock, e.size}
+			off += tarBlock + blocks(e.size)
+		}
+		if idxRaw, err = json.Marshal(idx); err != nil {
+			return BundleIndex{}, err
+		}
+		if blocks(int64(len(idxRaw))) == pad {
+			break
+		}
+		pad = blocks(int64(len(idxRaw)))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return BundleIndex{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*.tmp")
+	if err != nil {
+		return BundleIndex{}, err
+	}
+	defer os.Remove(tmp.Name()) // после rename уже нечего удалять
+
+	cw := &countingWriter{w: tmp}
+	tw := tar.NewWriter(cw)
+	put := func(name string, data []byte, want int64) error {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: idx.Created, Format: tar.FormatUSTAR}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if want >= 0 && cw.n != want {
+			return fmt.Errorf("bundle: %s at offset %d, index says %d", name, cw.n, want)
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	err = put(bundleIndexName, idxRaw, tarBlock)
+	for _, e := range entries {
+		if err != nil {
+			break
+		}
+		var raw []byte
+		if raw, err = os.ReadFile(e.path); err == nil && int64(len(raw)) != e.size {
+			err = fmt.Errorf("bundle: %s changed during export", e.path)
+		}
+		if err == nil {
+			err = put(e.name, raw, idx.Tiles[e.key][0])
+		}
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		return BundleIndex{}, err
+	}
+	return idx, os.Rename(tmp.Name(), out)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// parseCacheName разбирает "z/y/x.ext".
+func parseCacheName(name, ext string) (z, x, y int, ok bool) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, false
+	}
+	xs, hasExt := strings.CutSuffix(parts[2], ext)
+	z, err1 := strconv.Atoi(parts[0])
+	y, err2 := strconv.Atoi(parts[1])
+	x, err3 := strconv.Atoi(xs)
+	return z, x, y, hasExt && err1 == nil && err2 == nil && err3 == nil
+}
+
+type BundleImportStats struct {
+	Imported int
+	Existed  int // уже были в кэше (без overwrite)
+	Corrupt  int // не разобрались — пропущены
+}
+
+// ImportBundle раскладывает тайлы бандла в каталог кэша.
+func ImportBundle(path, dir string, overwrite bool) (BundleImportStats, error) {
+	var st BundleImportStats
+	b, err := OpenBundle(path)
+	if err != nil {
+		return st, err
+	}
+	defer b.Close()
+
+	keys := make([]string, 0, len(b.Index.Tiles))
+	for k := range b.Index.Tiles {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var z, x, y int
+		if _, err := fmt.Sscanf(k, "%d/%d/%d", &z, &y, &x); err != nil {
+			st.Corrupt++
+			continue
+		}
+		dst := TilePath(dir, b.Index.Format, z, x, y)
+		if !overwrite {
+			if _, err := os.Stat(dst); err == nil {
+				st.Existed++
+				continue
+			}
+		}
+		raw, err := b.ReadTile(z, x, y)
+		if err != nil {
+			return st, err
+		}
+		if _, err := decodeTile(b.Index.Format, raw, z, x, y, 1, nil); err != nil {
+			st.Corrupt++
+			continue
+		}
+		if err := writeFileAtomic(dst, raw); err != nil {
+			return st, err
+		}
+		st.Imported++
+	}
+	return st, nil
+}
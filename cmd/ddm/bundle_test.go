@@ -0,0 +1,149 @@
+package ddm
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleExportImport(t *testing.T) {
+	src := newTestStore(t)
+	const z = 10
+	x, y := tileXYZ(24.05, 55.78, z)
+	writeTile(t, src, z, x, y, 9, func(i, j int) float32 { return 100 + float32(j) })
+	writeTile(t, src, z, x+1, y, 5, func(i, j int) float32 { return 7 })
+	writeTile(t, src, z-1, x/2, y/2, 9, func(i, j int) float32 { return 50 })
+	fx, fy := tileXYZ(60, 10, z) // вне района
+	writeTile(t, src, z, fx, fy, 9, func(i, j int) float32 { return 1 })
+	_ = os.WriteFile(src.cachePath(z, x, y)+metaExt, []byte(`{}`), 0o644) // сайдкары не экспортируются
+
+	out := filepath.Join(t.TempDir(), "kit.tar")
+	idx, err := ExportBundle(src.cfg.CacheDir, out, BundleOptions{Area: BBox{South: 23, West: 55, North: 25, East: 57}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Tiles) != 3 || idx.MinZoom != z-1 || idx.MaxZoom != z || idx.Format != FormatDDM {
+		t.Fatalf("index: %d tiles z%d..%d %s", len(idx.Tiles), idx.MinZoom, idx.MaxZoom, idx.Format)
+	}
+
+	// обычный tar: index.json первым, дальше раскладка кэша
+	f, _ := os.Open(out)
+	tr := tar.NewReader(f)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	f.Close()
+	if len(names) != 4 || names[0] != bundleIndexName {
+		t.Fatalf("entries: %v", names)
+	}
+
+	// смещения индекса указывают ровно на байты тайлов
+	b, err := OpenBundle(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	for _, tl := range []TileID{{z, x, y}, {z, x + 1, y}, {z - 1, x / 2, y / 2}} {
+		got, err := b.ReadTile(tl.Z, tl.X, tl.Y)
+		want, _ := os.ReadFile(src.cachePath(tl.Z, tl.X, tl.Y))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("tile %+v: %v", tl, err)
+		}
+	}
+	if _, err := b.ReadTile(z, fx, fy); !errors.Is(err, ErrTileNotFound) {
+		t.Fatalf("outside tile: %v", err)
+	}
+
+	dst := t.TempDir()
+	st, err := ImportBundle(out, dst, false)
+	if err != nil || st.Imported != 3 {
+		t.Fatalf("import: %+v %v", st, err)
+	}
+	if st, _ := ImportBundle(out, dst, false); st.Existed != 3 || st.Imported != 0 {
+		t.Fatalf("reimport: %+v", st)
+	}
+	if _, err := os.Stat(TilePath(dst, FormatDDM, z, x+1, y)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreReadsBundle(t *testing.T) {
+	src := newTestStore(t)
+	const z = 10
+	x, y := tileXYZ(24.05, 55.78, z)
+	writeTile(t, src, z, x, y, 9, func(i, j int) float32 { return 321 })
+	out := filepath.Join(t.TempDir(), "kit.tar")
+	if _, err := ExportBundle(src.cfg.CacheDir, out, BundleOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// без CacheDir — только бандл
+	s, err := NewStore(StoreConfig{Bundle: out, DefaultZoom: z, HeightFactor: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, meta, err := s.Height(context.Background(), 24.05, 55.78, z)
+	if err != nil || math.Abs(h-321) > 1e-6 || meta.Source != "bundle" {
+		t.Fatalf("h=%v src=%q err=%v", h, meta.Source, err)
+	}
+	if _, _, err := s.Height(context.Background(), 60, 10, z); !errors.Is(err, ErrTileNotFound) {
+		t.Fatalf("missing tile: %v", err)
+	}
+	raw, _, src2, err := s.TileRaw(context.Background(), z, x, y)
+	if err != nil || src2 != "bundle" || len(raw) != 9*9*4 {
+		t.Fatalf("raw: %d %q %v", len(raw), src2, err)
+	}
+
+	if _, err := NewStore(StoreConfig{Bundle: out, CacheDir: t.TempDir(), Format: FormatTerrarium}); err == nil {
+		t.Fatal("format mismatch accepted")
+	}
+}
+
+func TestOpenBundleRejectsBadIndex(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+	write := func(name string, size int64, body []byte) string {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size, Format: tar.FormatGNU}); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(body) // мимо tar.Writer: заголовок может врать о размере
+		n++
+		p := filepath.Join(dir, fmt.Sprintf("b%d.tar", n))
+		if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	idx := `{"version":1,"format":"ddm","tiles":{"10/1/1":[512,100000]}}`
+	for name, path := range map[string]string{
+		"huge size":    write(bundleIndexName, 1<<40, []byte(`{}`)),
+		"truncated":    write(bundleIndexName, 4096, []byte(`{"version":1`)),
+		"not index":    write("10/1/1.ddm", 2, []byte(`{}`)),
+		"bad json":     write(bundleIndexName, 3, []byte(`{x}`)),
+		"no version":   write(bundleIndexName, 2, []byte(`{}`)),
+		"tile outside": write(bundleIndexName, int64(len(idx)), []byte(idx)),
+	} {
+		if b, err := OpenBundle(path); err == nil {
+			b.Close()
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
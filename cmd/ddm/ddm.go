@@ -3,7 +3,6 @@ package ddm
 import (
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"math"
 )
@@ -14,10 +13,15 @@ type tileData struct {
 	Values    []float32 // длина gs*gs
 	NoDataSet map[float32]struct{}
 	Factor    float32
+
+	// PixelIsArea — значения в центрах пикселей (PNG-тайлы), иначе узлы лежат на краях тайла (DDM, HGT)
+	PixelIsArea bool
+
+	Filled []bool // узлы, заполненные void-fill; nil — ничего не заполняли
 }
 
 func parseDDM(raw []byte, z, x, y int, factor float32, noData []float32) (*tileData, error) {
-	if len(raw)%4 != 0 {
+	if len(raw) == 0 || len(raw)%4 != 0 {
 		return nil, fmt.Errorf("ddm: payload not multiple of float32: %d", len(raw))
 	}
 	n := len(raw) / 4
@@ -51,69 +55,45 @@ func parseDDM(raw []byte, z, x, y int, factor float32, noData []float32) (*tileD
 	}, nil
 }
 
-func (t *tileData) at(i, j int) (float32, error) {
-	gs := t.GridSize
-	if i < 0 || j < 0 || i >= gs || j >= gs {
-		return 0, errors.New("index oob")
+// EncodeDDM — обратное к parseDDM: квадратная сетка float32 LE без заголовка.
+func EncodeDDM(vals []float32) ([]byte, error) {
+	gs := int(math.Round(math.Sqrt(float64(len(vals)))))
+	if gs*gs != len(vals) || gs < 2 {
+		return nil, fmt.Errorf("ddm: non-square grid: n=%d", len(vals))
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(vals) * 4)
+	if err := binary.Write(&buf, binary.LittleEndian, vals); err != nil {
+		return nil, err
 	}
-	return t.Values[i*gs+j], nil
+	return buf.Bytes(), nil
 }
 
-// Интерполяция как в _getGroundHeightMerc, но проще: билинейная по узлам.
-func (t *tileData) heightAtFrac(dx, dy float64) (float64, bool) {
+// node — значение узла с прижатием индексов к краю тайла; false для nodata.
+func (t *tileData) node(i, j int) (float32, bool) {
+	gs := t.GridSize
+	v := t.Values[min(max(i, 0), gs-1)*gs+min(max(j, 0), gs-1)]
+	_, nd := t.NoDataSet[v]
+	return v, !nd
+}
+
+// Интерполяция внутри одного тайла (HGT, GeoTIFF-подобные сетки).
+// Для меркаторных тайлов Store берёт tileSampler, который видит соседей.
+func (t *tileData) heightAtFrac(dx, dy float64, m Interp) (float64, Interp, bool) {
 	// dx,dy в [0..1) по тайлу
 	gs := t.GridSize
 	if gs < 2 {
-		return 0, false
-	}
-	px := dx * float64(gs-1)
-	py := dy * float64(gs-1)
-
-	j := int(math.Floor(px))
-	i := int(math.Floor(py))
-	if j < 0 {
-		j = 0
-	}
-	if i < 0 {
-		i = 0
-	}
-	if j >= gs-1 {
-		j = gs - 2
-	}
-	if i >= gs-1 {
-		i = gs - 2
-	}
-
-	fx := float64(px) - float64(j)
-	fy := float64(py) - float64(i)
-
-	p00, _ := t.at(i, j)
-	p10, _ := t.at(i, j+1)
-	p01, _ := t.at(i+1, j)
-	p11, _ := t.at(i+1, j+1)
-
-	// noData обработка: усредняем валидные
-	isND := func(v float32) bool {
-		_, ok := t.NoDataSet[v]
-		return ok
-	}
-	var sum float64
-	var cnt int
-	for _, v := range []float32{p00, p10, p01, p11} {
-		if !isND(v) {
-			sum += float64(v)
-			cnt++
-		}
-	}
-	if cnt == 0 {
-		return 0, false
+		return 0, m, false
 	}
-	// если все валидны — билинейная
-	if cnt == 4 {
-		a := (1-fx)*float64(p00) + fx*float64(p10)
-		b := (1-fx)*float64(p01) + fx*float64(p11)
-		return (1-fy)*a + fy*b, true
+	px, py := dx*float64(gs-1), dy*float64(gs-1)
+	if t.PixelIsArea {
+		// у края тайла полпикселя без соседа — прижимаем к крайнему центру
+		px = math.Min(math.Max(dx*float64(gs)-0.5, 0), float64(gs-1))
+		py = math.Min(math.Max(dy*float64(gs)-0.5, 0), float64(gs-1))
 	}
-	// иначе — просто среднее валидных (как fallback)
-	return sum / float64(cnt), true
+	i, fy := cell(py)
+	j, fx := cell(px)
+	i, fy = inner(i, fy, gs)
+	j, fx = inner(j, fx, gs)
+	return interpolate(m, i, j, fx, fy, t.node)
 }
@@ -2,22 +2,34 @@ package ddm
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/pavletto/altituder/cmd/terrain"
 )
 
-// Обёртка, приводящая ddm.Store к простому интерфейсу ElevationSource
+// Обёртка, приводящая Backend (ddm.Store, HGT, ...) к интерфейсу terrain.ElevationSource.
+// Отсутствие данных (nodata, нет тайла) отдаётся как terrain.ErrNoData,
+// остальные ошибки (сеть, таймаут) — как есть.
 type DEMAdapter struct {
-	Store   *Store
+	Source  Backend
 	Zoom    int
 	Timeout time.Duration
 }
 
-func (a *DEMAdapter) Height(lat, lon float64) float64 {
-	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
-	defer cancel()
-	h, _, err := a.Store.Height(ctx, lat, lon, a.Zoom)
+func (a *DEMAdapter) Height(ctx context.Context, lat, lon float64) (float64, error) {
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+	h, _, err := a.Source.Height(ctx, lat, lon, a.Zoom)
 	if err != nil {
-		return 0
+		if errors.Is(err, ErrNoData) || errors.Is(err, ErrTileNotFound) {
+			return 0, fmt.Errorf("%w: %w", terrain.ErrNoData, err)
+		}
+		return 0, err
 	}
-	return h
+	return h, nil
 }
@@ -0,0 +1,404 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// tileMeta — сайдкар {x}.ddm.meta рядом с тайлом: валидаторы для условной
+// перепроверки и время последнего чтения для вытеснения (mtime тайла не трогаем —
+// от него зависят ETag/Last-Modified в /tiles).
+type tileMeta struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched,omitzero"`
+	Accessed     time.Time `json:"accessed,omitzero"`
+}
+
+func writeTileMetaFile(tilePath string, m tileMeta) {
+	if raw, err := json.Marshal(m); err == nil {
+		_ = writeFileAtomic(tilePath+metaExt, raw)
+	}
+}
+
+const metaExt = ".meta"
+
+func readTileMeta(tilePath string) (tileMeta, error) {
+	var m tileMeta
+	raw, err := os.ReadFile(tilePath + metaExt)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(raw, &m)
+	return m, err
+}
+
+// writeTileMeta обновляет сайдкар по ответу апстрима (только при включённом TTL).
+// На 304 заголовков может не быть — тогда остаются прежние.
+func (s *Store) writeTileMeta(tilePath string, resp *http.Response) {
+	if s.cfg.DiskTTL <= 0 {
+		return
+	}
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	m, _ := readTileMeta(tilePath)
+	if v := resp.Header.Get("ETag"); v != "" {
+		m.ETag = v
+	}
+	if v := resp.Header.Get("Last-Modified"); v != "" {
+		m.LastModified = v
+	}
+	m.Fetched = time.Now().UTC()
+	writeTileMetaFile(tilePath, m)
+}
+
+// stale — тайл на диске старше DiskTTL и его пора перепроверить. Под TTL
+// только скачанные при включённом TTL тайлы (с Fetched в сайдкаре): тайлы из
+// build, bundle import или seed без TTL — локальные, апстрим их не перезаписывает.
+func (s *Store) stale(tilePath string) bool {
+	if s.cfg.DiskTTL <= 0 {
+		return false
+	}
+	m, err := readTileMeta(tilePath)
+	return err == nil && !m.Fetched.IsZero() && time.Since(m.Fetched) > s.cfg.DiskTTL
+}
+
+// touchEvery — как часто обновлять время доступа в сайдкаре при чтении.
+const touchEvery = time.Hour
+
+// revalRetry — пауза между фоновыми перепроверками одного тайла, в том числе
+// после неудачи: без связи апстрим не дёргается на каждом промахе памяти.
+const revalRetry = time.Minute
+
+// diskHit отмечает чтение тайла с диска: время доступа для вытеснения и, если
+// TTL вышел, фоновая перепроверка у апстрима — ответ отдаётся с диска сразу.
+func (s *Store) diskHit(z, x, y int) {
+	path := s.cachePath(z, x, y)
+	s.touchAccess(path)
+	if s.cfg.PermitDownload && s.stale(path) {
+		s.revalidate(z, x, y)
+	}
+}
+
+func (s *Store) touchAccess(path string) {
+	if s.disk == nil {
+		return
+	}
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	m, _ := readTileMeta(path)
+	if time.Since(m.Accessed) < touchEvery {
+		return
+	}
+	m.Accessed = time.Now().UTC()
+	writeTileMetaFile(path, m)
+}
+
+func (s *Store) revalidate(z, x, y int) {
+	key := fmt.Sprintf("%d/%d/%d", z, y, x)
+	s.missMu.Lock()
+	if t, ok := s.reval[key]; ok && time.Since(t) < revalRetry {
+		s.missMu.Unlock()
+		return
+	}
+	if len(s.reval) >= 10000 {
+		s.reval = make(map[string]time.Time)
+	}
+	s.reval[key] = time.Now()
+	s.missMu.Unlock()
+
+	go func() {
+		// download сам ограничен downloadTimeout; при ошибке запись остаётся до revalRetry
+		if _, _, err := s.downloadOnce(context.Background(), z, x, y, false); err == nil {
+			s.missMu.Lock()
+			delete(s.reval, key)
+			s.missMu.Unlock()
+		}
+	}()
+}
+
+// diskJanitor следит за размером кэша и в фоне запускает PruneCache,
+// когда он превышает лимит (или давно не чистился по возрасту).
+type diskJanitor struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	used      atomic.Int64 // -1 — ещё не считали
+	lastPrune atomic.Int64 // unix-секунды
+	running   atomic.Bool
+}
+
+func newDiskJanitor(dir string, maxBytes int64, maxAge time.Duration) *diskJanitor {
+	if maxBytes <= 0 && maxAge <= 0 {
+		return nil
+	}
+	j := &diskJanitor{dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+	j.used.Store(-1)
+	return j
+}
+
+// added учитывает записанный тайл; replaced — размер файла, который он заменил.
+func (j *diskJanitor) added(size, replaced int64) {
+	if j == nil {
+		return
+	}
+	u := j.used.Load()
+	if u >= 0 {
+		u = j.used.Add(size - replaced)
+	}
+	due := j.maxAge > 0 && time.Since(time.Unix(j.lastPrune.Load(), 0)) > touchEvery
+	if u < 0 || (j.maxBytes > 0 && u > j.maxBytes) || due {
+		j.kick()
+	}
+}
+
+func (j *diskJanitor) kick() {
+	if !j.running.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer j.running.Store(false)
+		// ужимаем с запасом, чтобы не чистить на каждой записи
+		res, err := PruneCache(j.dir, j.maxBytes*9/10, j.maxAge)
+		j.lastPrune.Store(time.Now().Unix())
+		if err == nil {
+			j.used.Store(res.Remaining)
+		}
+	}()
+}
+
+// ---------------- обход и обслуживание каталога кэша ----------------
+
+type cacheFile struct {
+	path string
+	z    int
+	size int64     // вместе с сайдкаром
+	used time.Time // последнее чтение из сайдкара, иначе mtime
+}
+
+type cacheScan struct {
+	tiles    []cacheFile
+	orphans  []string // сайдкары без тайла
+	temps    []string // недописанные .tmp
+	tmpOld   []string // .tmp старше часа — точно брошены
+	metaSize map[string]int64
+}
+
+func isTileFile(name string) bool {
+	ext := filepath.Ext(name)
+	return (ext == ".ddm" || ext == ".png") && !strings.HasPrefix(name, ".")
+}
+
+// LayerCacheDir — подкаталог кэша с кэшами отдельных тайловых слоёв
+// ({dir}/layers/{hash}/...). У них свой Store и своё обслуживание.
+const LayerCacheDir = "layers"
+
+// scanCache обходит {dir}/{z}/{y}/{x}.{ddm|png}; посторонние файлы и кэши слоёв не трогает.
+func scanCache(dir string) (cacheScan, error) {
+	sc := cacheScan{metaSize: make(map[string]int64)}
+	metas := make(map[string]bool)
+	layers := filepath.Join(dir, LayerCacheDir)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path == layers {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		fi, err := d.Info()
+		if err != nil {
+			return nil // файл исчез во время обхода
+		}
+		switch {
+		case strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp"):
+			sc.temps = append(sc.temps, path)
+			if time.Since(fi.ModTime()) > time.Hour {
+				sc.tmpOld = append(sc.tmpOld, path)
+			}
+		case strings.HasSuffix(name, metaExt) && isTileFile(strings.TrimSuffix(name, metaExt)):
+			metas[strings.TrimSuffix(path, metaExt)] = true
+			sc.metaSize[strings.TrimSuffix(path, metaExt)] = fi.Size()
+		case isTileFile(name):
+			rel, _ := filepath.Rel(dir, path)
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			if len(parts) != 3 {
+				return nil
+			}
+			z, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return nil
+			}
+			sc.tiles = append(sc.tiles, cacheFile{path: path, z: z, size: fi.Size(), used: fi.ModTime()})
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil // кэш ещё не создан — пустой
+	}
+	for i := range sc.tiles {
+		f := &sc.tiles[i]
+		if n, ok := sc.metaSize[f.path]; ok {
+			f.size += n
+			if m, err := readTileMeta(f.path); err == nil && m.Accessed.After(f.used) {
+				f.used = m.Accessed
+			}
+		}
+		delete(metas, f.path)
+	}
+	for p := range metas {
+		sc.orphans = append(sc.orphans, p+metaExt)
+	}
+	return sc, err
+}
+
+func removeTile(path string) {
+	_ = os.Remove(path)
+	_ = os.Remove(path + metaExt)
+}
+
+// removeEmptyDirs чистит опустевшие {z}/{y} (сам dir остаётся).
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != dir {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, d := range dirs {
+		_ = os.Remove(d) // не пустой — не удалится
+	}
+}
+
+// DiskStats — сводка по дисковому кэшу.
+type DiskStats struct {
+	Tiles    int         `json:"tiles"`
+	Bytes    int64       `json:"bytes"`
+	ByZoom   map[int]int `json:"by_zoom"`
+	Oldest   time.Time   `json:"oldest,omitempty"` // по последнему доступу
+	Newest   time.Time   `json:"newest,omitempty"`
+	Temp     int         `json:"temp"`
+	Orphaned int         `json:"orphaned_meta"`
+}
+
+func ScanCache(dir string) (DiskStats, error) {
+	sc, err := scanCache(dir)
+	st := DiskStats{Tiles: len(sc.tiles), ByZoom: make(map[int]int), Temp: len(sc.temps), Orphaned: len(sc.orphans)}
+	for _, f := range sc.tiles {
+		st.Bytes += f.size
+		st.ByZoom[f.z]++
+		if st.Oldest.IsZero() || f.used.Before(st.Oldest) {
+			st.Oldest = f.used
+		}
+		if f.used.After(st.Newest) {
+			st.Newest = f.used
+		}
+	}
+	return st, err
+}
+
+type PruneResult struct {
+	Removed   int   `json:"removed"`
+	Freed     int64 `json:"freed"`
+	Remaining int64 `json:"remaining"`
+}
+
+// PruneCache удаляет тайлы, к которым не обращались дольше maxAge, затем
+// давно не читанные, пока кэш не ужмётся до maxBytes.
+// Заодно убирает брошенные .tmp и сайдкары без тайлов. 0 — без ограничения.
+func PruneCache(dir string, maxBytes int64, maxAge time.Duration) (PruneResult, error) {
+	sc, err := scanCache(dir)
+	if err != nil {
+		return PruneResult{}, err
+	}
+	var res PruneResult
+	for _, p := range append(sc.tmpOld, sc.orphans...) {
+		_ = os.Remove(p)
+	}
+
+	sort.Slice(sc.tiles, func(i, j int) bool { return sc.tiles[i].used.Before(sc.tiles[j].used) })
+	var total int64
+	for _, f := range sc.tiles {
+		total += f.size
+	}
+	for _, f := range sc.tiles {
+		old := maxAge > 0 && time.Since(f.used) > maxAge
+		big := maxBytes > 0 && total > maxBytes
+		if !old && !big {
+			if maxAge <= 0 {
+				break // дальше только свежее
+			}
+			continue
+		}
+		removeTile(f.path)
+		total -= f.size
+		res.Removed++
+		res.Freed += f.size
+	}
+	if res.Removed > 0 {
+		removeEmptyDirs(dir)
+	}
+	res.Remaining = total
+	return res, nil
+}
+
+// VerifyCache разбирает каждый тайл; битые (обрезанные, не квадратные, не PNG)
+// возвращает, а с fix — удаляет.
+func VerifyCache(dir string, fix bool) (bad []string, checked int, err error) {
+	sc, err := scanCache(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, f := range sc.tiles {
+		raw, err := os.ReadFile(f.path)
+		if err == nil {
+			// формула высоты для проверки не важна — важна целостность PNG
+			format := FormatDDM
+			if filepath.Ext(f.path) == ".png" {
+				format = FormatTerrainRGB
+			}
+			_, err = decodeTile(format, raw, f.z, 0, 0, 1, nil)
+		}
+		checked++
+		if err != nil {
+			bad = append(bad, f.path)
+			if fix {
+				removeTile(f.path)
+			}
+		}
+	}
+	if fix && len(bad) > 0 {
+		removeEmptyDirs(dir)
+	}
+	return bad, checked, nil
+}
+
+// ClearCache удаляет все тайлы, сайдкары и .tmp; посторонние файлы остаются.
+func ClearCache(dir string) (int, error) {
+	sc, err := scanCache(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range sc.tiles {
+		removeTile(f.path)
+	}
+	for _, p := range append(sc.temps, sc.orphans...) {
+		_ = os.Remove(p)
+	}
+	removeEmptyDirs(dir)
+	return len(sc.tiles), nil
+}
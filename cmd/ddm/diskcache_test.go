@@ -0,0 +1,378 @@
+package ddm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func flatDDM(gs int, v float32) []byte {
+	vals := make([]float32, gs*gs)
+	for i := range vals {
+		vals[i] = v
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, vals)
+	return buf.Bytes()
+}
+
+func TestDiskTTLRevalidation(t *testing.T) {
+	var hits, notModified atomic.Int32
+	var v2 atomic.Bool   // апстрим обновил тайл
+	var hang atomic.Bool // апстрим не отвечает
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if hang.Load() {
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		etag, height := `"v1"`, float32(100)
+		if v2.Load() {
+			etag, height = `"v2"`, 200
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(flatDDM(9, height))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// новый Store на каждом шаге — с пустой памятью, кэш только на диске
+	dir := t.TempDir()
+	open := func() *Store {
+		s, err := NewStore(StoreConfig{
+			CacheDir:       dir,
+			URLTemplate:    srv.URL + "/{z}/{y}/{x}.ddm",
+			PermitDownload: true,
+			DefaultZoom:    10,
+			HeightFactor:   1,
+			DiskTTL:        time.Hour,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	s := open()
+	ctx := context.Background()
+	const z = 10
+	x, y := tileXYZ(24.05, 55.78, z)
+	path := s.cachePath(z, x, y)
+	eventually := func(what string, ok func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !ok(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for %s", what)
+			}
+		}
+	}
+
+	if _, src, err := s.tile(ctx, z, x, y); err != nil || src != "download" {
+		t.Fatalf("first: src=%q err=%v", src, err)
+	}
+	m, err := readTileMeta(path)
+	if err != nil || m.ETag != `"v1"` {
+		t.Fatalf("meta: %+v %v", m, err)
+	}
+
+	// свежий — апстрим не трогаем
+	if _, src, _ := open().tile(ctx, z, x, y); src != "disk-cache" || hits.Load() != 1 {
+		t.Fatalf("fresh: src=%q hits=%d", src, hits.Load())
+	}
+
+	// протух — ответ сразу с диска, условный запрос в фоне, 304
+	stale := func() {
+		m.Fetched = time.Now().Add(-2 * time.Hour)
+		raw, _ := json.Marshal(m)
+		_ = os.WriteFile(path+metaExt, raw, 0o644)
+	}
+	stale()
+	if _, src, err := open().tile(ctx, z, x, y); err != nil || src != "disk-cache" {
+		t.Fatalf("stale: src=%q err=%v", src, err)
+	}
+	eventually("304", func() bool {
+		m2, _ := readTileMeta(path)
+		return notModified.Load() == 1 && time.Since(m2.Fetched) < time.Minute && m2.ETag == `"v1"`
+	})
+
+	// тайл у апстрима поменялся — в фоне 200, следующее чтение видит новую высоту
+	v2.Store(true)
+	stale()
+	if td, _, _ := open().tile(ctx, z, x, y); td.Values[0] != 100 {
+		t.Fatalf("stale copy expected, got %v", td.Values[0])
+	}
+	eventually("200", func() bool {
+		m2, _ := readTileMeta(path)
+		return m2.ETag == `"v2"`
+	})
+	if td, _, _ := open().tile(ctx, z, x, y); td.Values[0] != 200 {
+		t.Fatalf("updated tile: %v", td.Values[0])
+	}
+
+	// апстрим висит — отдаём протухшую копию не дожидаясь его, и не дёргаем повторно
+	hang.Store(true)
+	stale()
+	s = open()
+	before := hits.Load()
+	start := time.Now()
+	_, src, err := s.tile(ctx, z, x, y)
+	if err != nil || src != "disk-cache" || time.Since(start) > time.Second {
+		t.Fatalf("offline: src=%q err=%v in %s", src, err, time.Since(start))
+	}
+	eventually("revalidation attempt", func() bool { return hits.Load() == before+1 })
+	s.diskHit(z, x, y)
+	raw, _, src, err := s.TileRaw(ctx, z, x, y)
+	if err != nil || src != "disk-cache" || len(raw) != 9*9*4 {
+		t.Fatalf("tile raw offline: src=%q err=%v", src, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := hits.Load(); n != before+1 {
+		t.Fatalf("upstream hit %d times while revalidation pending", n-before)
+	}
+}
+
+func TestDiskTTLKeepsLocalTiles(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write(flatDDM(17, -1))
+	}))
+	defer srv.Close()
+
+	const z = 10
+	dir := t.TempDir()
+	area := BBox{South: 24.99, West: 55.99, North: 25.01, East: 56.01}
+	src := rampBackend{bbox: BBox{South: 24.5, West: 55.5, North: 25.5, East: 56.5}}
+	if _, err := BuildTiles(context.Background(), src, area, BuildConfig{OutDir: dir, MinZoom: z, MaxZoom: z, GridSize: 17}); err != nil {
+		t.Fatal(err)
+	}
+	// тайл из build: сайдкара нет, потом появляется только время доступа
+	for i := 0; i < 2; i++ {
+		s, err := NewStore(StoreConfig{
+			CacheDir:       dir,
+			URLTemplate:    srv.URL + "/{z}/{y}/{x}.ddm",
+			PermitDownload: true,
+			DefaultZoom:    z,
+			HeightFactor:   1,
+			DiskTTL:        time.Hour,
+			MaxDiskBytes:   1 << 20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h, meta, err := s.Height(context.Background(), 25, 56, z); err != nil || math.Abs(h-56000) > 0.01 || meta.Source == "download" {
+			t.Fatalf("read %d: h=%v meta=%+v err=%v", i, h, meta, err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond) // фоновая перепроверка успела бы сходить к апстриму
+	if n := hits.Load(); n != 0 {
+		t.Fatalf("built tile revalidated: %d upstream hits", n)
+	}
+}
+
+func TestAccessTimeInSidecar(t *testing.T) {
+	s, err := NewStore(StoreConfig{CacheDir: t.TempDir(), DefaultZoom: 10, HeightFactor: 1, MaxDiskBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const z = 10
+	x, y := tileXYZ(24.05, 55.78, z)
+	writeTile(t, s, z, x, y, 9, func(i, j int) float32 { return 1 })
+	path := s.cachePath(z, x, y)
+	old := time.Now().Add(-48 * time.Hour)
+	_ = os.Chtimes(path, old, old)
+
+	// чтение через /tiles тоже считается доступом, mtime (ETag/Last-Modified) не меняется
+	_, mod, _, err := s.TileRaw(context.Background(), z, x, y)
+	if err != nil || !mod.Equal(old) {
+		t.Fatalf("mod=%v err=%v", mod, err)
+	}
+	m, err := readTileMeta(path)
+	if err != nil || time.Since(m.Accessed) > time.Minute {
+		t.Fatalf("accessed not recorded: %+v %v", m, err)
+	}
+	if fi, _ := os.Stat(path); !fi.ModTime().Equal(old) {
+		t.Fatalf("mtime touched: %v", fi.ModTime())
+	}
+
+	// при вытеснении читанный тайл новее нетронутого с более свежим mtime
+	other := TilePath(s.cfg.CacheDir, FormatDDM, z, x+1, y)
+	writeTile(t, s, z, x+1, y, 9, func(i, j int) float32 { return 1 })
+	mid := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(other, mid, mid)
+	if _, err := PruneCache(s.cfg.CacheDir, 9*9*4+200, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("recently read tile evicted")
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Fatal("unread tile kept")
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	dir := t.TempDir()
+	raw := flatDDM(9, 1) // 324 байта
+	now := time.Now()
+	put := func(rel string, age time.Duration) string {
+		p := filepath.Join(dir, rel)
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, raw, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(p, now.Add(-age), now.Add(-age))
+		return p
+	}
+	ancient := put("10/1/1.ddm", 100*24*time.Hour)
+	old := put("10/1/2.ddm", 3*time.Hour)
+	mid := put("10/2/1.ddm", 2*time.Hour)
+	fresh := put("11/2/2.ddm", time.Minute)
+	_ = os.WriteFile(old+metaExt, []byte(`{}`), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "10/3.ddm.meta"), []byte(`{}`), 0o644) // сирота
+	_ = os.WriteFile(filepath.Join(dir, "README"), []byte("keep"), 0o644)
+
+	st, err := ScanCache(dir)
+	if err != nil || st.Tiles != 4 || st.ByZoom[10] != 3 || st.Orphaned != 1 {
+		t.Fatalf("scan: %+v %v", st, err)
+	}
+
+	// по возрасту уходит только древний, по размеру — дальше самые давние
+	res, err := PruneCache(dir, 2*int64(len(raw)), 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != 2 || res.Remaining != 2*int64(len(raw)) {
+		t.Fatalf("prune: %+v", res)
+	}
+	for _, p := range []string{ancient, old, old + metaExt, filepath.Join(dir, "10/3.ddm.meta")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", p)
+		}
+	}
+	for _, p := range []string{mid, fresh, filepath.Join(dir, "README")} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s should stay: %v", p, err)
+		}
+	}
+}
+
+func TestLayerCachesLeftAlone(t *testing.T) {
+	dir := t.TempDir()
+	raw := flatDDM(9, 1)
+	layer := filepath.Join(dir, LayerCacheDir, "0123abcd", "10", "1")
+	main := filepath.Join(dir, "10", "1")
+	for _, d := range []string{layer, main} {
+		_ = os.MkdirAll(d, 0o755)
+		_ = os.WriteFile(filepath.Join(d, "1.ddm"), raw, 0o644)
+		_ = os.WriteFile(filepath.Join(d, "1.ddm"+metaExt), []byte(`{}`), 0o644)
+	}
+	tmp := filepath.Join(layer, ".2.ddm.123.tmp")
+	_ = os.WriteFile(tmp, raw, 0o644)
+	old := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(tmp, old, old)
+
+	st, err := ScanCache(dir)
+	if err != nil || st.Tiles != 1 || st.Orphaned != 0 || st.Temp != 0 {
+		t.Fatalf("scan: %+v %v", st, err)
+	}
+	if _, err := PruneCache(dir, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ClearCache(dir); err != nil || n != 1 {
+		t.Fatalf("clear: %d %v", n, err)
+	}
+	for _, name := range []string{"1.ddm", "1.ddm" + metaExt, ".2.ddm.123.tmp"} {
+		if _, err := os.Stat(filepath.Join(layer, name)); err != nil {
+			t.Errorf("layer %s removed: %v", name, err)
+		}
+	}
+	// кэш слоя обслуживается сам по себе
+	if st, err := ScanCache(filepath.Join(dir, LayerCacheDir, "0123abcd")); err != nil || st.Tiles != 1 || st.Temp != 1 {
+		t.Errorf("layer scan: %+v %v", st, err)
+	}
+}
+
+func TestVerifyAndClearCache(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "10", "1", "1.ddm")
+	bad := filepath.Join(dir, "10", "1", "2.ddm")
+	_ = os.MkdirAll(filepath.Dir(good), 0o755)
+	_ = os.WriteFile(good, flatDDM(9, 1), 0o644)
+	_ = os.WriteFile(bad, flatDDM(9, 1)[:130], 0o644) // обрезан
+
+	found, checked, err := VerifyCache(dir, false)
+	if err != nil || checked != 2 || len(found) != 1 || found[0] != bad {
+		t.Fatalf("verify: %v %d %v", found, checked, err)
+	}
+	if _, err := os.Stat(bad); err != nil {
+		t.Fatal("verify without fix must not delete")
+	}
+	if _, _, err := VerifyCache(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Fatal("corrupt tile not removed")
+	}
+
+	n, err := ClearCache(dir)
+	if err != nil || n != 1 {
+		t.Fatalf("clear: %d %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "10")); !os.IsNotExist(err) {
+		t.Fatal("empty dirs left")
+	}
+}
+
+func TestDiskUsageOnReplace(t *testing.T) {
+	var big atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gs := 9
+		if big.Load() {
+			gs = 17
+		}
+		_, _ = w.Write(flatDDM(gs, 100))
+	}))
+	defer srv.Close()
+	s, err := NewStore(StoreConfig{
+		CacheDir: t.TempDir(), URLTemplate: srv.URL + "/{z}/{y}/{x}.ddm", PermitDownload: true,
+		DefaultZoom: 10, HeightFactor: 1, MaxDiskBytes: 1 << 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.disk.used.Store(0) // как после первого обхода каталога
+	fetch := func() {
+		t.Helper()
+		if _, err := s.fetchTile(context.Background(), 10, 1, 2, func(raw []byte) error { return checkTile(FormatDDM, raw) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	small, large := int64(len(flatDDM(9, 0))), int64(len(flatDDM(17, 0)))
+
+	fetch()
+	fetch() // перекачка того же тайла не растит учёт
+	if u := s.disk.used.Load(); u != small {
+		t.Errorf("after re-download used=%d, want %d", u, small)
+	}
+	big.Store(true)
+	fetch()
+	if u := s.disk.used.Load(); u != large {
+		t.Errorf("after replace with larger tile used=%d, want %d", u, large)
+	}
+}
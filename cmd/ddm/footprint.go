@@ -0,0 +1,133 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+type footprintRequest struct {
+	intersectionRequest
+	HFOV   float64 `json:"hfov"`
+	VFOV   float64 `json:"vfov"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+}
+
+// HandleFootprint отдаёт GeoJSON Feature с полигоном проекции кадра на рельеф.
+// Параметры позы — как у /intersection, плюс hfov/vfov (градусы) и width/height (пиксели).
+func (s *Server) HandleFootprint(w http.ResponseWriter, r *http.Request) {
+	req, err := parseFootprintRequest(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	params, err := s.raycastParams(&req.intersectionRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fpp := terrain.FootprintParams{
+		RaycastParams: params,
+		HFOV:          req.HFOV,
+		VFOV:          req.VFOV,
+		Width:         req.Width,
+		Height:        req.Height,
+	}
+	if _, _, err := fpp.FOV(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	fp, err := terrain.CameraFootprint(ctx, fpp)
+	if err != nil {
+		http.Error(w, "raycast failed: "+err.Error(), terrainErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	_ = json.NewEncoder(w).Encode(footprintFeature(fp))
+}
+
+// Угол, не попавший в землю, замыкается концом луча на max_dist или точкой,
+// где кончились данные рельефа ("unknown") — см. "complete".
+func footprintFeature(fp terrain.Footprint) map[string]any {
+	ray := func(r terrain.RaycastResult) map[string]any {
+		m := map[string]any{"hit": r.Hit, "lat": r.Lat, "lon": r.Lon}
+		if r.Hit {
+			m["ground"] = r.Ground
+			m["range"] = r.Range
+		}
+		if r.Unknown {
+			m["unknown"] = true
+		}
+		return m
+	}
+	ring := make([][2]float64, 0, 5)
+	corners := make([]map[string]any, 0, 4)
+	for _, c := range fp.Corners {
+		ring = append(ring, [2]float64{c.Lon, c.Lat})
+		corners = append(corners, ray(c))
+	}
+	ring = append(ring, ring[0])
+
+	return map[string]any{
+		"type": "Feature",
+		"geometry": map[string]any{
+			"type":        "Polygon",
+			"coordinates": [][][2]float64{ring},
+		},
+		"properties": map[string]any{
+			"complete": fp.Complete(),
+			"center":   ray(fp.Center),
+			"corners":  corners, // TL, TR, BR, BL
+			"hfov":     fp.HFOV,
+			"vfov":     fp.VFOV,
+		},
+	}
+}
+
+func parseFootprintRequest(w http.ResponseWriter, r *http.Request) (*footprintRequest, error) {
+	req := &footprintRequest{intersectionRequest: *newIntersectionRequest()}
+	if r.Method == http.MethodPost {
+		if err := decodeJSONBody(w, r, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	q := r.URL.Query()
+	if err := req.parseQuery(q); err != nil {
+		return nil, err
+	}
+	var err error
+	if v := q.Get("hfov"); v != "" {
+		if req.HFOV, err = queryFloat(v); err != nil {
+			return nil, fmt.Errorf("invalid hfov")
+		}
+	}
+	if v := q.Get("vfov"); v != "" {
+		if req.VFOV, err = queryFloat(v); err != nil {
+			return nil, fmt.Errorf("invalid vfov")
+		}
+	}
+	if v := q.Get("width"); v != "" {
+		if req.Width, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid width")
+		}
+	}
+	if v := q.Get("height"); v != "" {
+		if req.Height, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid height")
+		}
+	}
+	return req, nil
+}
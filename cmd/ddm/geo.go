@@ -0,0 +1,20 @@
+package ddm
+
+import (
+	"math"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+// Расстояние по большому кругу (haversine), м
+func haversine(a, b LatLon) float64 {
+	return terrain.Distance(a.Lat, a.Lon, b.Lat, b.Lon)
+}
+
+// Промежуточная точка на дуге большого круга, f в [0..1]
+func intermediate(a, b LatLon, f float64) LatLon {
+	lat, lon := terrain.Intermediate(a.Lat, a.Lon, b.Lat, b.Lon, f)
+	return LatLon{Lat: lat, Lon: lon}
+}
+
+func deg(r float64) float64 { return r * 180.0 / math.Pi }
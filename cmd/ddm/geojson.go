@@ -0,0 +1,191 @@
+package ddm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type LatLon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// минимальная модель GeoJSON: геометрия или Feature с геометрией
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Geometries  []geoJSON       `json:"geometries"` // GeometryCollection
+	Features    []geoJSON       `json:"features"`   // FeatureCollection
+}
+
+// parseGeoJSONPoints достаёт вершины из Point/MultiPoint/LineString (в т.ч. внутри Feature).
+// Порядок координат GeoJSON — lon,lat.
+func parseGeoJSONPoints(raw []byte) ([]LatLon, error) {
+	var g geoJSON
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, err
+	}
+	if g.Type == "Feature" {
+		if g.Geometry == nil {
+			return nil, fmt.Errorf("geojson: feature without geometry")
+		}
+		g = *g.Geometry
+	}
+	switch g.Type {
+	case "Point":
+		var c []float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("geojson: %w", err)
+		}
+		p, err := lonLatPosition(c)
+		if err != nil {
+			return nil, err
+		}
+		return []LatLon{p}, nil
+	case "MultiPoint", "LineString":
+		var cs [][]float64
+		if err := json.Unmarshal(g.Coordinates, &cs); err != nil {
+			return nil, fmt.Errorf("geojson: %w", err)
+		}
+		out := make([]LatLon, 0, len(cs))
+		for _, c := range cs {
+			p, err := lonLatPosition(c)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("geojson: unsupported type %q", g.Type)
+	}
+}
+
+func lonLatPosition(c []float64) (LatLon, error) {
+	if len(c) < 2 {
+		return LatLon{}, fmt.Errorf("geojson: position needs at least 2 numbers")
+	}
+	return LatLon{Lat: c[1], Lon: c[0]}, nil
+}
+
+func lonLatRing(cs [][]float64) ([]LatLon, error) {
+	out := make([]LatLon, 0, len(cs))
+	for _, c := range cs {
+		p, err := lonLatPosition(c)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// ParseGeoJSONArea превращает GeoJSON в район для предзагрузки: полигоны берутся
+// по внешнему контуру (дырки не вычитаются), линии и точки — коридором bufferM метров.
+// Коллекции объединяются.
+func ParseGeoJSONArea(raw []byte, bufferM float64) (Area, error) {
+	var g geoJSON
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, err
+	}
+	return geoJSONArea(g, bufferM)
+}
+
+func geoJSONArea(g geoJSON, bufferM float64) (Area, error) {
+	var parts []geoJSON
+	switch g.Type {
+	case "Feature":
+		if g.Geometry == nil {
+			return nil, fmt.Errorf("geojson: feature without geometry")
+		}
+		return geoJSONArea(*g.Geometry, bufferM)
+	case "FeatureCollection":
+		parts = g.Features
+	case "GeometryCollection":
+		parts = g.Geometries
+	}
+	if parts != nil {
+		var set AreaSet
+		for _, p := range parts {
+			a, err := geoJSONArea(p, bufferM)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, a)
+		}
+		if len(set) == 0 {
+			return nil, fmt.Errorf("geojson: empty %s", g.Type)
+		}
+		return set, nil
+	}
+
+	var rings [][][]float64
+	switch g.Type {
+	case "Point":
+		var c []float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("geojson: %w", err)
+		}
+		rings = [][][]float64{{c}}
+	case "MultiPoint", "LineString":
+		var cs [][]float64
+		if err := json.Unmarshal(g.Coordinates, &cs); err != nil {
+			return nil, fmt.Errorf("geojson: %w", err)
+		}
+		rings = [][][]float64{cs}
+	case "MultiLineString", "Polygon":
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return nil, fmt.Errorf("geojson: %w", err)
+		}
+	case "MultiPolygon":
+		var polys [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polys); err != nil {
+			return nil, fmt.Errorf("geojson: %w", err)
+		}
+		var area Polygons
+		for _, p := range polys {
+			if len(p) == 0 {
+				continue
+			}
+			r, err := lonLatRing(p[0])
+			if err != nil {
+				return nil, err
+			}
+			area = append(area, r)
+		}
+		return area, area.validate()
+	default:
+		return nil, fmt.Errorf("geojson: unsupported type %q", g.Type)
+	}
+
+	if g.Type == "Polygon" {
+		if len(rings) == 0 {
+			return nil, fmt.Errorf("geojson: polygon without rings")
+		}
+		r, err := lonLatRing(rings[0])
+		if err != nil {
+			return nil, err
+		}
+		area := Polygons{r}
+		return area, area.validate()
+	}
+	var set AreaSet
+	for _, cs := range rings {
+		path, err := lonLatRing(cs)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			continue
+		}
+		set = append(set, Corridor{Path: path, BufferM: bufferM})
+	}
+	if len(set) == 1 {
+		return set[0], nil
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("geojson: empty %s", g.Type)
+	}
+	return set, nil
+}
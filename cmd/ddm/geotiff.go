@@ -0,0 +1,545 @@
+package ddm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+// TIFF/GeoTIFF теги
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPredictor       = 317
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+	tagModelPixelScale = 33550
+	tagModelTiepoint   = 33922
+	tagModelTransform  = 34264
+	tagGeoKeyDirectory = 34735
+	tagGDALNoData      = 42113
+
+	// ключи GeoKeyDirectory
+	keyGTModelType     = 1024
+	keyGTRasterType    = 1025
+	keyGeographicType  = 2048
+	keyProjectedCSType = 3072
+
+	modelTypeProjected  = 1
+	modelTypeGeographic = 2
+	rasterPixelIsPoint  = 2
+
+	compressionNone       = 1
+	compressionLZW        = 5
+	compressionDeflate    = 8
+	compressionDeflateOld = 32946
+)
+
+const (
+	crsGeographic  = iota // EPSG:4326
+	crsWebMercator        // EPSG:3857
+)
+
+// Размеры из заголовка не должны заставлять выделять память без меры.
+const (
+	maxGeoTIFFPixels = 1 << 27 // 512 МБ отсчётов float32
+	// DEFLATE сжимает не сильнее ~1032:1, TIFF-LZW с 12-битными кодами — ~1400:1
+	maxTIFFRatio = 2048
+)
+
+// GeoTIFF — одноканальный растр высот, целиком загруженный в память.
+// Поддерживаются полосы и тайлы, int16/uint16/int32/float32/float64,
+// без сжатия, LZW и DEFLATE, предикторы 2 и 3, системы EPSG:4326 и EPSG:3857.
+type GeoTIFF struct {
+	Path       string
+	Cols, Rows int
+	Values     []float32
+
+	hasNoData bool
+	noData    float32
+	crs       int
+	geo       [6]float64 // центр пикселя (col,row) → X = a*c+b*r+c0, Y = d*c+e*r+f0
+	inv       [6]float64
+}
+
+func OpenGeoTIFF(path string) (*GeoTIFF, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := parseGeoTIFF(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	g.Path = path
+	return g, nil
+}
+
+func (g *GeoTIFF) name() string { return filepath.Base(g.Path) }
+
+func (g *GeoTIFF) Height(ctx context.Context, lat, lon float64, _ int) (float64, Meta, error) {
+	meta := Meta{Source: "geotiff", Name: g.name(), GridSize: g.Cols}
+	h, used, err := g.heightAt(lat, lon, interpFrom(ctx, InterpBilinear))
+	meta.Interp = used
+	return h, meta, err
+}
+
+func (g *GeoTIFF) HeightBatch(ctx context.Context, pts []LatLon, z int) []PointResult {
+	out := make([]PointResult, len(pts))
+	for i, p := range pts {
+		if err := ctx.Err(); err != nil {
+			out[i].Err = err
+			continue
+		}
+		out[i].Height, out[i].Meta, out[i].Err = g.Height(ctx, p.Lat, p.Lon, z)
+	}
+	return out
+}
+
+// Bounds — охват растра по центрам крайних пикселей, градусы.
+func (g *GeoTIFF) Bounds() (south, west, north, east float64) {
+	south, west, north, east = 90, 180, -90, -180
+	for _, c := range [4][2]float64{{0, 0}, {float64(g.Cols - 1), 0}, {0, float64(g.Rows - 1)}, {float64(g.Cols - 1), float64(g.Rows - 1)}} {
+		lat, lon := g.pixelToLatLon(c[0], c[1])
+		south, north = math.Min(south, lat), math.Max(north, lat)
+		west, east = math.Min(west, lon), math.Max(east, lon)
+	}
+	return
+}
+
+func (g *GeoTIFF) pixelToLatLon(col, row float64) (lat, lon float64) {
+	x := g.geo[0]*col + g.geo[1]*row + g.geo[2]
+	y := g.geo[3]*col + g.geo[4]*row + g.geo[5]
+	if g.crs == crsWebMercator {
+		return deg(2*math.Atan(math.Exp(y/terrain.RadiusOfEarth)) - math.Pi/2), deg(x / terrain.RadiusOfEarth)
+	}
+	return y, x
+}
+
+func (g *GeoTIFF) heightAt(lat, lon float64, m Interp) (float64, Interp, error) {
+	x, y := lon, lat
+	if g.crs == crsWebMercator {
+		if lat > maxLat || lat < minLat {
+			return 0, m, fmt.Errorf("%w: outside %s", ErrTileNotFound, g.name())
+		}
+		x = terrain.RadiusOfEarth * rad(lon)
+		y = terrain.RadiusOfEarth * math.Log(math.Tan(math.Pi/4+rad(lat)/2))
+	}
+	col := g.inv[0]*x + g.inv[1]*y + g.inv[2]
+	row := g.inv[3]*x + g.inv[4]*y + g.inv[5]
+	// полпикселя за крайними центрами ещё принадлежит растру
+	if col < -0.5 || row < -0.5 || col > float64(g.Cols)-0.5 || row > float64(g.Rows)-0.5 {
+		return 0, m, fmt.Errorf("%w: outside %s", ErrTileNotFound, g.name())
+	}
+	i, fy := cell(math.Max(0, math.Min(row, float64(g.Rows-1))))
+	j, fx := cell(math.Max(0, math.Min(col, float64(g.Cols-1))))
+	i, fy = inner(i, fy, g.Rows)
+	j, fx = inner(j, fx, g.Cols)
+	v, used, ok := interpolate(m, i, j, fx, fy, g.node)
+	if !ok {
+		return 0, used, ErrNoData
+	}
+	return v, used, nil
+}
+
+// node — пиксель с прижатием к краю растра; false для nodata и NaN.
+func (g *GeoTIFF) node(i, j int) (float32, bool) {
+	v := g.Values[min(max(i, 0), g.Rows-1)*g.Cols+min(max(j, 0), g.Cols-1)]
+	if g.hasNoData && v == g.noData || math.IsNaN(float64(v)) {
+		return v, false
+	}
+	return v, true
+}
+
+// ---------------- разбор TIFF ----------------
+
+type tiffField struct {
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+type tiffReader struct {
+	raw    []byte
+	bo     binary.ByteOrder
+	fields map[uint16]tiffField
+}
+
+func parseGeoTIFF(raw []byte) (*GeoTIFF, error) {
+	if len(raw) < 8 {
+		return nil, fmt.Errorf("tiff: file too short")
+	}
+	t := &tiffReader{raw: raw, fields: make(map[uint16]tiffField)}
+	switch string(raw[:2]) {
+	case "II":
+		t.bo = binary.LittleEndian
+	case "MM":
+		t.bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("tiff: bad byte order mark")
+	}
+	switch t.bo.Uint16(raw[2:]) {
+	case 42:
+	case 43:
+		return nil, fmt.Errorf("tiff: BigTIFF not supported")
+	default:
+		return nil, fmt.Errorf("tiff: bad magic")
+	}
+	if err := t.readIFD(int(t.bo.Uint32(raw[4:]))); err != nil {
+		return nil, err
+	}
+
+	g := &GeoTIFF{
+		Cols: t.int(tagImageWidth, 0),
+		Rows: t.int(tagImageLength, 0),
+	}
+	if g.Cols <= 0 || g.Rows <= 0 {
+		return nil, fmt.Errorf("tiff: missing image size")
+	}
+	if spp := t.int(tagSamplesPerPixel, 1); spp != 1 {
+		return nil, fmt.Errorf("tiff: %d samples per pixel, single band expected", spp)
+	}
+	if err := t.readRaster(g); err != nil {
+		return nil, err
+	}
+	if err := t.readGeo(g); err != nil {
+		return nil, err
+	}
+	if f, ok := t.fields[tagGDALNoData]; ok {
+		s := strings.TrimSpace(strings.TrimRight(string(f.data), "\x00"))
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			g.hasNoData, g.noData = true, float32(v)
+		}
+	}
+	return g, nil
+}
+
+func (t *tiffReader) readIFD(off int) error {
+	if off <= 0 || off+2 > len(t.raw) {
+		return fmt.Errorf("tiff: bad IFD offset")
+	}
+	n := int(t.bo.Uint16(t.raw[off:]))
+	if off+2+n*12 > len(t.raw) {
+		return fmt.Errorf("tiff: truncated IFD")
+	}
+	for k := 0; k < n; k++ {
+		e := t.raw[off+2+k*12:]
+		tag, typ, count := t.bo.Uint16(e), t.bo.Uint16(e[2:]), t.bo.Uint32(e[4:])
+		size := tiffTypeSize(typ)
+		if size == 0 {
+			continue
+		}
+		total := int(count) * size
+		var data []byte
+		if total <= 4 {
+			data = e[8 : 8+total]
+		} else {
+			p := int(t.bo.Uint32(e[8:]))
+			if p < 0 || p+total > len(t.raw) {
+				return fmt.Errorf("tiff: tag %d points outside file", tag)
+			}
+			data = t.raw[p : p+total]
+		}
+		t.fields[tag] = tiffField{typ: typ, count: count, data: data}
+	}
+	return nil
+}
+
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+// floats отдаёт значения тега любого числового типа.
+func (t *tiffReader) floats(tag uint16) []float64 {
+	f, ok := t.fields[tag]
+	if !ok {
+		return nil
+	}
+	out := make([]float64, f.count)
+	for i := range out {
+		switch f.typ {
+		case 1, 7:
+			out[i] = float64(f.data[i])
+		case 6:
+			out[i] = float64(int8(f.data[i]))
+		case 3:
+			out[i] = float64(t.bo.Uint16(f.data[i*2:]))
+		case 8:
+			out[i] = float64(int16(t.bo.Uint16(f.data[i*2:])))
+		case 4:
+			out[i] = float64(t.bo.Uint32(f.data[i*4:]))
+		case 9:
+			out[i] = float64(int32(t.bo.Uint32(f.data[i*4:])))
+		case 11:
+			out[i] = float64(math.Float32frombits(t.bo.Uint32(f.data[i*4:])))
+		case 5:
+			out[i] = float64(t.bo.Uint32(f.data[i*8:])) / float64(t.bo.Uint32(f.data[i*8+4:]))
+		case 10:
+			out[i] = float64(int32(t.bo.Uint32(f.data[i*8:]))) / float64(int32(t.bo.Uint32(f.data[i*8+4:])))
+		case 12:
+			out[i] = math.Float64frombits(t.bo.Uint64(f.data[i*8:]))
+		}
+	}
+	return out
+}
+
+func (t *tiffReader) int(tag uint16, def int) int {
+	if v := t.floats(tag); len(v) > 0 {
+		return int(v[0])
+	}
+	return def
+}
+
+func (t *tiffReader) ints(tag uint16) []int {
+	fs := t.floats(tag)
+	out := make([]int, len(fs))
+	for i, v := range fs {
+		out[i] = int(v)
+	}
+	return out
+}
+
+func (t *tiffReader) readRaster(g *GeoTIFF) error {
+	bps := t.int(tagBitsPerSample, 1)
+	format := t.int(tagSampleFormat, 1)
+	compression := t.int(tagCompression, compressionNone)
+	predictor := t.int(tagPredictor, 1)
+
+	var decode func(b []byte) float32
+	switch {
+	case format == 2 && bps == 16:
+		decode = func(b []byte) float32 { return float32(int16(t.bo.Uint16(b))) }
+	case format == 1 && bps == 16:
+		decode = func(b []byte) float32 { return float32(t.bo.Uint16(b)) }
+	case format == 2 && bps == 32:
+		decode = func(b []byte) float32 { return float32(int32(t.bo.Uint32(b))) }
+	case format == 3 && bps == 32:
+		decode = func(b []byte) float32 { return math.Float32frombits(t.bo.Uint32(b)) }
+	case format == 3 && bps == 64:
+		decode = func(b []byte) float32 { return float32(math.Float64frombits(t.bo.Uint64(b))) }
+	default:
+		return fmt.Errorf("tiff: unsupported sample type: format=%d bits=%d", format, bps)
+	}
+	switch compression {
+	case compressionNone, compressionLZW, compressionDeflate, compressionDeflateOld:
+	default:
+		return fmt.Errorf("tiff: unsupported compression %d", compression)
+	}
+	if predictor == 3 && format != 3 {
+		return fmt.Errorf("tiff: floating point predictor on integer data")
+	}
+	bytesPer := bps / 8
+	pixels := int64(g.Cols) * int64(g.Rows)
+	if pixels > maxGeoTIFFPixels {
+		return fmt.Errorf("tiff: %dx%d raster too large (max %d pixels)", g.Cols, g.Rows, maxGeoTIFFPixels)
+	}
+	ratio := int64(1)
+	if compression != compressionNone {
+		ratio = maxTIFFRatio
+	}
+	if pixels*int64(bytesPer) > int64(len(t.raw))*ratio {
+		return fmt.Errorf("tiff: %dx%d raster does not fit in a %d-byte file", g.Cols, g.Rows, len(t.raw))
+	}
+
+	// блоки: полосы — это тайлы шириной во всё изображение
+	bw, bh := g.Cols, t.int(tagRowsPerStrip, g.Rows)
+	offsets, counts := t.ints(tagStripOffsets), t.ints(tagStripByteCounts)
+	if _, tiled := t.fields[tagTileOffsets]; tiled {
+		bw, bh = t.int(tagTileWidth, 0), t.int(tagTileLength, 0)
+		offsets, counts = t.ints(tagTileOffsets), t.ints(tagTileByteCounts)
+	}
+	if bw <= 0 || bh <= 0 || len(offsets) == 0 || len(offsets) != len(counts) {
+		return fmt.Errorf("tiff: bad strip/tile layout")
+	}
+	if bh > g.Rows {
+		bh = g.Rows
+	}
+	if int64(bw)*int64(bh) > maxGeoTIFFPixels {
+		return fmt.Errorf("tiff: %dx%d block too large", bw, bh)
+	}
+	across := (g.Cols + bw - 1) / bw
+	down := (g.Rows + bh - 1) / bh
+	if len(offsets) < across*down {
+		return fmt.Errorf("tiff: %d blocks, expected %d", len(offsets), across*down)
+	}
+
+	g.Values = make([]float32, g.Cols*g.Rows)
+	for b := 0; b < across*down; b++ {
+		off, n := offsets[b], counts[b]
+		if off < 0 || n < 0 || off+n > len(t.raw) {
+			return fmt.Errorf("tiff: block %d outside file", b)
+		}
+		want := bw * bh * bytesPer
+		blk, err := decompress(t.raw[off:off+n], compression, want)
+		if err != nil {
+			return fmt.Errorf("tiff: block %d: %w", b, err)
+		}
+		// последняя полоса может быть короче
+		rows := bh
+		if len(blk) < want {
+			rows = len(blk) / (bw * bytesPer)
+		}
+		if err := unpredict(blk[:rows*bw*bytesPer], predictor, bw, bytesPer, t.bo); err != nil {
+			return err
+		}
+		bx, by := (b%across)*bw, (b/across)*bh
+		for r := 0; r < rows && by+r < g.Rows; r++ {
+			for c := 0; c < bw && bx+c < g.Cols; c++ {
+				p := (r*bw + c) * bytesPer
+				g.Values[(by+r)*g.Cols+bx+c] = decode(blk[p : p+bytesPer])
+			}
+		}
+	}
+	return nil
+}
+
+// decompress распаковывает блок; want — его полный размер, больше — ошибка.
+func decompress(src []byte, compression, want int) ([]byte, error) {
+	switch compression {
+	case compressionLZW:
+		return lzwDecode(src, want)
+	case compressionDeflate, compressionDeflateOld:
+		zr, err := zlib.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, int64(want)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > want {
+			return nil, fmt.Errorf("deflate: output exceeds %d-byte block", want)
+		}
+		return out, nil
+	}
+	return src, nil
+}
+
+// unpredict снимает предиктор: 2 — горизонтальные разности по отсчётам,
+// 3 — разности по байтам с раскладкой байтов по плоскостям (старший первым).
+func unpredict(blk []byte, predictor, width, bytesPer int, bo binary.ByteOrder) error {
+	rowLen := width * bytesPer
+	switch predictor {
+	case 1:
+	case 2:
+		for r := 0; r+rowLen <= len(blk); r += rowLen {
+			row := blk[r : r+rowLen]
+			for i := bytesPer; i < rowLen; i += bytesPer {
+				switch bytesPer {
+				case 2:
+					bo.PutUint16(row[i:], bo.Uint16(row[i:])+bo.Uint16(row[i-2:]))
+				case 4:
+					bo.PutUint32(row[i:], bo.Uint32(row[i:])+bo.Uint32(row[i-4:]))
+				case 8:
+					bo.PutUint64(row[i:], bo.Uint64(row[i:])+bo.Uint64(row[i-8:]))
+				}
+			}
+		}
+	case 3:
+		tmp := make([]byte, rowLen)
+		for r := 0; r+rowLen <= len(blk); r += rowLen {
+			row := blk[r : r+rowLen]
+			for i := 1; i < rowLen; i++ {
+				row[i] += row[i-1]
+			}
+			copy(tmp, row)
+			for i := 0; i < width; i++ {
+				for k := 0; k < bytesPer; k++ {
+					// плоскость k хранит k-й по старшинству байт
+					v := tmp[k*width+i]
+					if bo == binary.LittleEndian {
+						row[i*bytesPer+bytesPer-1-k] = v
+					} else {
+						row[i*bytesPer+k] = v
+					}
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("tiff: unsupported predictor %d", predictor)
+	}
+	return nil
+}
+
+func (t *tiffReader) readGeo(g *GeoTIFF) error {
+	keys := map[int]int{}
+	if d := t.ints(tagGeoKeyDirectory); len(d) >= 4 {
+		for k := 0; k < d[3] && 4+k*4+3 < len(d); k++ {
+			e := d[4+k*4:]
+			if e[1] == 0 { // значение прямо в записи
+				keys[e[0]] = e[3]
+			}
+		}
+	}
+
+	switch keys[keyGTModelType] {
+	case modelTypeGeographic:
+		g.crs = crsGeographic
+	case modelTypeProjected:
+		switch keys[keyProjectedCSType] {
+		case 3857, 3785, 900913, 102100, 102113:
+			g.crs = crsWebMercator
+		default:
+			return fmt.Errorf("geotiff: unsupported projected CRS EPSG:%d (4326 or 3857 expected)", keys[keyProjectedCSType])
+		}
+	default:
+		if gt := keys[keyGeographicType]; gt != 0 && gt != 4326 {
+			return fmt.Errorf("geotiff: unsupported geographic CRS EPSG:%d", gt)
+		}
+		g.crs = crsGeographic
+	}
+
+	// PixelIsArea (по умолчанию): привязка к углу пикселя, центр — +0.5
+	half := 0.5
+	if keys[keyGTRasterType] == rasterPixelIsPoint {
+		half = 0
+	}
+	if m := t.floats(tagModelTransform); len(m) >= 8 {
+		g.geo = [6]float64{m[0], m[1], m[3] + half*(m[0]+m[1]), m[4], m[5], m[7] + half*(m[4]+m[5])}
+	} else {
+		scale, tie := t.floats(tagModelPixelScale), t.floats(tagModelTiepoint)
+		if len(scale) < 2 || len(tie) < 6 {
+			return fmt.Errorf("geotiff: no georeferencing (ModelPixelScale/ModelTiepoint or ModelTransformation)")
+		}
+		sx, sy := scale[0], scale[1]
+		g.geo = [6]float64{sx, 0, tie[3] + (half-tie[0])*sx, 0, -sy, tie[4] - (half-tie[1])*sy}
+	}
+
+	a, b, c, d, e, f := g.geo[0], g.geo[1], g.geo[2], g.geo[3], g.geo[4], g.geo[5]
+	det := a*e - b*d
+	if math.Abs(det) < 1e-18 {
+		return fmt.Errorf("geotiff: degenerate geotransform")
+	}
+	g.inv = [6]float64{e / det, -b / det, (b*f - c*e) / det, -d / det, a / det, (c*d - a*f) / det}
+	return nil
+}
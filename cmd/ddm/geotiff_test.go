@@ -0,0 +1,375 @@
+package ddm
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+type testTag struct {
+	tag, typ uint16
+	vals     []float64
+	ascii    string
+}
+
+// buildTIFF собирает минимальный TIFF: заголовок, блоки данных, IFD, внешние значения тегов.
+func buildTIFF(bo binary.ByteOrder, tags []testTag, blocks [][]byte, tiled bool) []byte {
+	var buf bytes.Buffer
+	if bo == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	_ = binary.Write(&buf, bo, uint16(42))
+	_ = binary.Write(&buf, bo, uint32(0)) // смещение IFD, допишем ниже
+
+	var offs, cnts []float64
+	for _, b := range blocks {
+		offs = append(offs, float64(buf.Len()))
+		cnts = append(cnts, float64(len(b)))
+		buf.Write(b)
+	}
+	offTag, cntTag := uint16(tagStripOffsets), uint16(tagStripByteCounts)
+	if tiled {
+		offTag, cntTag = tagTileOffsets, tagTileByteCounts
+	}
+	tags = append(tags, testTag{tag: offTag, typ: 4, vals: offs}, testTag{tag: cntTag, typ: 4, vals: cnts})
+	sort.Slice(tags, func(i, j int) bool { return tags[i].tag < tags[j].tag })
+
+	if buf.Len()%2 == 1 {
+		buf.WriteByte(0)
+	}
+	ifd := buf.Len()
+	extra := ifd + 2 + len(tags)*12 + 4
+	var ext bytes.Buffer
+	_ = binary.Write(&buf, bo, uint16(len(tags)))
+	for _, t := range tags {
+		var data bytes.Buffer
+		count := len(t.vals)
+		switch t.typ {
+		case 2:
+			data.WriteString(t.ascii + "\x00")
+			count = data.Len()
+		case 3:
+			for _, v := range t.vals {
+				_ = binary.Write(&data, bo, uint16(v))
+			}
+		case 4:
+			for _, v := range t.vals {
+				_ = binary.Write(&data, bo, uint32(v))
+			}
+		case 12:
+			for _, v := range t.vals {
+				_ = binary.Write(&data, bo, v)
+			}
+		}
+		_ = binary.Write(&buf, bo, t.tag)
+		_ = binary.Write(&buf, bo, t.typ)
+		_ = binary.Write(&buf, bo, uint32(count))
+		if data.Len() <= 4 {
+			b := make([]byte, 4)
+			copy(b, data.Bytes())
+			buf.Write(b)
+		} else {
+			_ = binary.Write(&buf, bo, uint32(extra+ext.Len()))
+			ext.Write(data.Bytes())
+		}
+	}
+	_ = binary.Write(&buf, bo, uint32(0))
+	buf.Write(ext.Bytes())
+
+	out := buf.Bytes()
+	bo.PutUint32(out[4:], uint32(ifd))
+	return out
+}
+
+// lzwEncode — эталонный TIFF-LZW кодер (как в libtiff): таблица строк,
+// ранняя смена ширины кода и сброс таблицы при заполнении.
+func lzwEncode(src []byte) []byte {
+	var out []byte
+	var acc uint64
+	var n uint
+	width := uint(9)
+	emit := func(code int) {
+		acc = acc<<width | uint64(code)
+		n += width
+		for n >= 8 {
+			out = append(out, byte(acc>>(n-8)))
+			n -= 8
+		}
+	}
+	type key struct{ prefix, c int }
+	table := make(map[key]int)
+	next := lzwFirst
+	// после каждого кода декодер добавляет запись — ширина растёт синхронно с ним
+	grow := func() {
+		next++
+		if next >= 1<<width && width < 12 {
+			width++
+		}
+	}
+
+	emit(lzwClear)
+	w := -1
+	for _, b := range src {
+		c := int(b)
+		if w < 0 {
+			w = c
+			continue
+		}
+		if code, ok := table[key{w, c}]; ok {
+			w = code
+			continue
+		}
+		emit(w)
+		table[key{w, c}] = next
+		grow()
+		if next == lzwMax-2 {
+			emit(lzwClear)
+			clear(table)
+			next, width = lzwFirst, 9
+		}
+		w = c
+	}
+	if w >= 0 {
+		emit(w)
+		grow()
+	}
+	emit(lzwEOI)
+	if n > 0 {
+		out = append(out, byte(acc<<(8-n)))
+	}
+	return out
+}
+
+func TestLZWRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	noise := make([]byte, 64<<10) // малый алфавит: таблица заполняется и сбрасывается много раз
+	for i := range noise {
+		noise[i] = byte('a' + rnd.IntN(6))
+	}
+	for name, src := range map[string][]byte{
+		"empty":  nil,
+		"single": {42},
+		"kwkwk":  bytes.Repeat([]byte{'x'}, 5000), // код, ещё не попавший в таблицу декодера
+		"text":   bytes.Repeat([]byte("TOBEORNOTTOBEORTOBEORNOT#"), 400),
+		"noise":  noise,
+	} {
+		enc := lzwEncode(src)
+		got, err := lzwDecode(enc, len(src))
+		if err != nil || !bytes.Equal(got, src) {
+			t.Errorf("%s: err=%v, got %d bytes, want %d", name, err, len(got), len(src))
+		}
+		if len(src) > 1000 && len(enc) >= len(src) {
+			t.Errorf("%s: %d -> %d bytes, table not used", name, len(src), len(enc))
+		}
+	}
+}
+
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, _ = zw.Write(b)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func writeTIFF(t *testing.T, raw []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dem.tif")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func geoTags(w, h int, scale, tie []float64, model, code int, extra ...testTag) []testTag {
+	codeKey := keyGeographicType
+	if model == modelTypeProjected {
+		codeKey = keyProjectedCSType
+	}
+	return append([]testTag{
+		{tag: tagImageWidth, typ: 3, vals: []float64{float64(w)}},
+		{tag: tagImageLength, typ: 3, vals: []float64{float64(h)}},
+		{tag: tagModelPixelScale, typ: 12, vals: scale},
+		{tag: tagModelTiepoint, typ: 12, vals: tie},
+		{tag: tagGeoKeyDirectory, typ: 3, vals: []float64{
+			1, 1, 0, 2,
+			keyGTModelType, 0, 1, float64(model),
+			float64(codeKey), 0, 1, float64(code),
+		}},
+	}, extra...)
+}
+
+func TestGeoTIFFStrippedInt16(t *testing.T) {
+	const w, h = 5, 4
+	val := func(i, j int) int16 { return int16(100 + 10*i + j) }
+
+	for _, tc := range []struct {
+		name        string
+		compression int
+		predictor   int
+	}{
+		{"none", compressionNone, 1},
+		{"lzw+predictor", compressionLZW, 2},
+		{"deflate", compressionDeflate, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bo := binary.LittleEndian
+			// две полосы по 2 строки
+			var blocks [][]byte
+			for s := 0; s < 2; s++ {
+				var b bytes.Buffer
+				for i := s * 2; i < s*2+2; i++ {
+					prev := int16(0)
+					for j := 0; j < w; j++ {
+						v := val(i, j)
+						if i == 3 && j == 4 {
+							v = -9999
+						}
+						if tc.predictor == 2 {
+							v, prev = v-prev, v
+						}
+						_ = binary.Write(&b, bo, v)
+					}
+				}
+				switch tc.compression {
+				case compressionLZW:
+					blocks = append(blocks, lzwEncode(b.Bytes()))
+				case compressionDeflate:
+					blocks = append(blocks, deflate(b.Bytes()))
+				default:
+					blocks = append(blocks, b.Bytes())
+				}
+			}
+			tags := geoTags(w, h, []float64{0.01, 0.01, 0}, []float64{0, 0, 0, 55, 25, 0}, modelTypeGeographic, 4326,
+				testTag{tag: tagBitsPerSample, typ: 3, vals: []float64{16}},
+				testTag{tag: tagSampleFormat, typ: 3, vals: []float64{2}},
+				testTag{tag: tagCompression, typ: 3, vals: []float64{float64(tc.compression)}},
+				testTag{tag: tagPredictor, typ: 3, vals: []float64{float64(tc.predictor)}},
+				testTag{tag: tagRowsPerStrip, typ: 3, vals: []float64{2}},
+				testTag{tag: tagGDALNoData, typ: 2, ascii: "-9999"},
+			)
+			g, err := OpenGeoTIFF(writeTIFF(t, buildTIFF(bo, tags, blocks, false)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			// центр пикселя (1,2): PixelIsArea → +0.5 пикселя от угла
+			if v, _, err := g.Height(ctx, 24.985, 55.025, 0); err != nil || math.Abs(v-112) > 1e-6 {
+				t.Errorf("pixel (1,2): h=%v err=%v", v, err)
+			}
+			if v, _, err := g.Height(ctx, 24.985, 55.030, 0); err != nil || math.Abs(v-112.5) > 1e-6 {
+				t.Errorf("between columns: h=%v err=%v", v, err)
+			}
+			if v, _, err := g.Height(ctx, 24.965, 55.045, 0); err != nil || v < 0 {
+				t.Errorf("nodata corner leaked: h=%v err=%v", v, err)
+			}
+			if _, _, err := g.Height(ctx, 24.99, 54.9, 0); !errors.Is(err, ErrTileNotFound) {
+				t.Errorf("outside: err=%v", err)
+			}
+		})
+	}
+}
+
+func TestGeoTIFFTiledFloat32Mercator(t *testing.T) {
+	const w, h, tile = 20, 20, 16
+	bo := binary.BigEndian
+	val := func(i, j int) float32 { return float32(i*w+j) + 0.25 }
+
+	var blocks [][]byte
+	for ty := 0; ty < 2; ty++ {
+		for tx := 0; tx < 2; tx++ {
+			raw := make([]byte, tile*tile*4)
+			for r := 0; r < tile; r++ {
+				row := make([]byte, tile*4)
+				for c := 0; c < tile; c++ {
+					v := float32(0)
+					if i, j := ty*tile+r, tx*tile+c; i < h && j < w {
+						v = val(i, j)
+					}
+					// предиктор 3: байтовые плоскости, старший байт первым, затем разности
+					bits := math.Float32bits(v)
+					for k := 0; k < 4; k++ {
+						row[k*tile+c] = byte(bits >> (24 - 8*k))
+					}
+				}
+				for i := len(row) - 1; i > 0; i-- {
+					row[i] -= row[i-1]
+				}
+				copy(raw[r*tile*4:], row)
+			}
+			blocks = append(blocks, deflate(raw))
+		}
+	}
+	x0 := 6378137 * rad(55)
+	y0 := 6378137 * math.Log(math.Tan(math.Pi/4+rad(25)/2))
+	tags := geoTags(w, h, []float64{100, 100, 0}, []float64{0, 0, 0, x0, y0, 0}, modelTypeProjected, 3857,
+		testTag{tag: tagBitsPerSample, typ: 3, vals: []float64{32}},
+		testTag{tag: tagSampleFormat, typ: 3, vals: []float64{3}},
+		testTag{tag: tagCompression, typ: 3, vals: []float64{compressionDeflate}},
+		testTag{tag: tagPredictor, typ: 3, vals: []float64{3}},
+		testTag{tag: tagTileWidth, typ: 3, vals: []float64{tile}},
+		testTag{tag: tagTileLength, typ: 3, vals: []float64{tile}},
+	)
+	g, err := OpenGeoTIFF(writeTIFF(t, buildTIFF(bo, tags, blocks, true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range [][2]int{{0, 0}, {5, 17}, {19, 19}, {17, 3}} {
+		lat, lon := g.pixelToLatLon(float64(p[1]), float64(p[0]))
+		v, meta, err := g.Height(context.Background(), lat, lon, 0)
+		if err != nil || math.Abs(v-float64(val(p[0], p[1]))) > 1e-3 {
+			t.Errorf("pixel %v: h=%v err=%v", p, v, err)
+		}
+		if meta.Source != "geotiff" || meta.Name != "dem.tif" {
+			t.Errorf("meta=%+v", meta)
+		}
+	}
+	s, w0, n, e := g.Bounds()
+	if !(s < 25 && n < 25 && w0 > 55 && e > w0 && n > s) {
+		t.Errorf("bounds: %v %v %v %v", s, w0, n, e)
+	}
+}
+
+func TestGeoTIFFSizeLimits(t *testing.T) {
+	bo := binary.LittleEndian
+	open := func(w, h, compression int, block []byte) error {
+		tags := geoTags(w, h, []float64{0.01, 0.01, 0}, []float64{0, 0, 0, 55, 25, 0}, modelTypeGeographic, 4326,
+			testTag{tag: tagBitsPerSample, typ: 3, vals: []float64{16}},
+			testTag{tag: tagSampleFormat, typ: 3, vals: []float64{2}},
+			testTag{tag: tagCompression, typ: 3, vals: []float64{float64(compression)}},
+		)
+		_, err := OpenGeoTIFF(writeTIFF(t, buildTIFF(bo, tags, [][]byte{block}, false)))
+		return err
+	}
+	small := make([]byte, 4*4*2)
+	if err := open(4, 4, compressionNone, small); err != nil {
+		t.Fatalf("valid raster: %v", err)
+	}
+
+	// заголовок обещает гигантский растр, файл — сотня байт
+	if err := open(60000, 60000, compressionNone, small); err == nil {
+		t.Error("oversized raster accepted")
+	}
+	if err := open(4000, 4000, compressionNone, small); err == nil {
+		t.Error("raster larger than the file accepted")
+	}
+
+	// блок распаковывается в больше, чем 4×4 отсчёта
+	bomb := make([]byte, 1<<20)
+	if err := open(4, 4, compressionDeflate, deflate(bomb)); err == nil {
+		t.Error("deflate output beyond the block accepted")
+	}
+	if err := open(4, 4, compressionLZW, lzwEncode(bomb[:1000])); err == nil {
+		t.Error("lzw output beyond the block accepted")
+	}
+}
@@ -0,0 +1,256 @@
+package ddm
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	hgtVoid    = -32768          // пустоты в SRTM
+	maxHGTSize = 3601 * 3601 * 2 // SRTM1, крупнее тайлов не бывает
+)
+
+// HGTStore читает градусные тайлы SRTM (.hgt, в т.ч. внутри .zip) из локального каталога.
+// Формат: big-endian int16, сетка 1201×1201 (SRTM3) или 3601×3601 (SRTM1),
+// строка 0 — северный край, узлы лежат на границах тайла.
+type HGTStore struct {
+	Dir string
+
+	mu      sync.Mutex
+	mem     *lru
+	missing map[string]time.Time // отсутствующие тайлы, на missingTTL
+}
+
+// NewHGTStore: maxTiles и maxBytes ограничивают кэш распакованных тайлов,
+// что наступит раньше. SRTM1 во float32 занимает ~52 МБ, SRTM3 — ~6 МБ.
+func NewHGTStore(dir string, maxTiles int, maxBytes int64) (*HGTStore, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, fmt.Errorf("hgt: %s is not a directory", dir)
+	}
+	if maxTiles <= 0 {
+		maxTiles = 16
+	}
+	if maxBytes <= 0 {
+		maxBytes = 256 << 20
+	}
+	return &HGTStore{Dir: dir, mem: newLRU(maxTiles, maxBytes), missing: make(map[string]time.Time)}, nil
+}
+
+func (h *HGTStore) Height(ctx context.Context, lat, lon float64, _ int) (float64, Meta, error) {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, Meta{}, fmt.Errorf("coordinates out of range")
+	}
+	tn := TileNameFor(lat, lon)
+	td, src, err := h.tile(ctx, tn)
+	meta := hgtMeta(tn, src, td)
+	if err != nil {
+		return 0, meta, err
+	}
+	v, used, ok := hgtHeight(td, tn, lat, lon, interpFrom(ctx, InterpBilinear))
+	meta.Interp = used
+	if !ok {
+		return 0, meta, ErrNoData
+	}
+	return v, meta, nil
+}
+
+func (h *HGTStore) HeightBatch(ctx context.Context, pts []LatLon, _ int) []PointResult {
+	out := make([]PointResult, len(pts))
+	groups := make(map[TileName][]int)
+	var order []TileName
+	for i, p := range pts {
+		if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+			out[i].Err = fmt.Errorf("coordinates out of range")
+			continue
+		}
+		tn := TileNameFor(p.Lat, p.Lon)
+		if _, ok := groups[tn]; !ok {
+			order = append(order, tn)
+		}
+		groups[tn] = append(groups[tn], i)
+	}
+	for _, tn := range order {
+		idx := groups[tn]
+		if err := ctx.Err(); err != nil {
+			for _, i := range idx {
+				out[i].Err = err
+			}
+			continue
+		}
+		td, src, err := h.tile(ctx, tn)
+		m := interpFrom(ctx, InterpBilinear)
+		for _, i := range idx {
+			out[i].Meta = hgtMeta(tn, src, td)
+			if err != nil {
+				out[i].Err = err
+				continue
+			}
+			v, used, ok := hgtHeight(td, tn, pts[i].Lat, pts[i].Lon, m)
+			out[i].Meta.Interp = used
+			if !ok {
+				out[i].Err = ErrNoData
+				continue
+			}
+			out[i].Height = v
+		}
+	}
+	return out
+}
+
+// Stats — счётчики кэша распакованных тайлов.
+func (h *HGTStore) Stats() CacheStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.mem.stats()
+}
+
+func hgtMeta(tn TileName, src string, td *tileData) Meta {
+	lat, lon := tn.SouthWest()
+	m := Meta{X: int(lon), Y: int(lat), Source: src, Name: tn.FileStem()}
+	if td != nil {
+		m.GridSize = td.GridSize
+	}
+	return m
+}
+
+func hgtHeight(td *tileData, tn TileName, lat, lon float64, m Interp) (float64, Interp, bool) {
+	south, west := tn.SouthWest()
+	return td.heightAtFrac(lon-west, 1-(lat-south), m)
+}
+
+func (h *HGTStore) tile(_ context.Context, tn TileName) (*tileData, string, error) {
+	stem := tn.FileStem()
+	h.mu.Lock()
+	if td, ok := h.mem.get(stem); ok {
+		h.mu.Unlock()
+		return td, "hgt:mem-cache", nil
+	}
+	if t, ok := h.missing[stem]; ok {
+		if time.Since(t) <= missingTTL {
+			h.mu.Unlock()
+			return nil, "", fmt.Errorf("%w: %s", ErrTileNotFound, stem)
+		}
+		delete(h.missing, stem) // тайл могли докачать в каталог
+	}
+	h.mu.Unlock()
+
+	raw, err := h.readTile(stem)
+	if errors.Is(err, fs.ErrNotExist) {
+		h.mu.Lock()
+		if len(h.missing) >= 10000 {
+			h.missing = make(map[string]time.Time)
+		}
+		h.missing[stem] = time.Now()
+		h.mu.Unlock()
+		return nil, "", fmt.Errorf("%w: %s", ErrTileNotFound, stem)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	td, err := parseHGT(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", stem, err)
+	}
+	h.mu.Lock()
+	h.mem.put(stem, td)
+	h.mu.Unlock()
+	return td, "hgt:disk", nil
+}
+
+// readTile ищет тайл в каталоге и подкаталоге широтной полосы (N24/),
+// в виде .hgt или .hgt.zip (в т.ч. с именами NASA: N24E055.SRTMGL1.hgt.zip).
+func (h *HGTStore) readTile(stem string) ([]byte, error) {
+	names := []string{
+		stem + ".hgt",
+		stem + ".hgt.zip",
+		stem + ".SRTMGL1.hgt.zip",
+		stem + ".SRTMGL3.hgt.zip",
+	}
+	for _, dir := range []string{h.Dir, filepath.Join(h.Dir, stem[:3])} {
+		for _, n := range names {
+			for _, name := range []string{n, strings.ToLower(n)} {
+				path := filepath.Join(dir, name)
+				fi, err := os.Stat(path)
+				if err != nil {
+					continue
+				}
+				if strings.HasSuffix(name, ".zip") {
+					return readHGTZip(path)
+				}
+				if fi.Size() > maxHGTSize {
+					return nil, fmt.Errorf("hgt: %s larger than an SRTM1 tile", path)
+				}
+				return os.ReadFile(path)
+			}
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func readHGTZip(path string) ([]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".hgt") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		raw, err := io.ReadAll(io.LimitReader(rc, maxHGTSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > maxHGTSize {
+			return nil, fmt.Errorf("hgt: %s in %s larger than an SRTM1 tile", f.Name, path)
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("hgt: no .hgt inside %s", path)
+}
+
+func parseHGT(raw []byte) (*tileData, error) {
+	if len(raw)%2 != 0 {
+		return nil, fmt.Errorf("hgt: odd payload size %d", len(raw))
+	}
+	n := len(raw) / 2
+	gs := int(math.Round(math.Sqrt(float64(n))))
+	if gs*gs != n || gs < 2 {
+		return nil, fmt.Errorf("hgt: non-square grid: n=%d", n)
+	}
+	ints := make([]int16, n)
+	if err := binary.Read(bytes.NewReader(raw), binary.BigEndian, ints); err != nil {
+		return nil, err
+	}
+	vals := make([]float32, n)
+	for i, v := range ints {
+		vals[i] = float32(v)
+	}
+	return &tileData{
+		GridSize:  gs,
+		Values:    vals,
+		NoDataSet: map[float32]struct{}{hgtVoid: {}},
+		Factor:    1,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package ddm
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// hgtBytes — SRTM3-тайл, высота растёт на 1 м на каждую строку к югу
+func hgtBytes(t *testing.T, void [2]int) []byte {
+	t.Helper()
+	const gs = 1201
+	vals := make([]int16, gs*gs)
+	for i := 0; i < gs; i++ {
+		for j := 0; j < gs; j++ {
+			vals[i*gs+j] = int16(i)
+		}
+	}
+	vals[void[0]*gs+void[1]] = hgtVoid
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, vals); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTileNameForEdges(t *testing.T) {
+	for _, tc := range []struct {
+		lat, lon float64
+		want     string
+	}{
+		{24.5, 55.5, "N24E055"},
+		{-0.5, -0.5, "S01W001"},
+		{90, 180, "N89E179"},
+		{89.5, 179.5, "N89E179"},
+		{-90, -180, "S90W180"},
+	} {
+		if got := TileNameFor(tc.lat, tc.lon).FileStem(); got != tc.want {
+			t.Errorf("%v,%v: %s, want %s", tc.lat, tc.lon, got, tc.want)
+		}
+	}
+}
+
+func TestHGTStore(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "N24E055.hgt"), hgtBytes(t, [2]int{600, 600}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// южное полушарие, внутри zip
+	f, err := os.Create(filepath.Join(dir, "S01W001.hgt.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	zf, _ := zw.Create("S01W001.hgt")
+	_, _ = zf.Write(hgtBytes(t, [2]int{0, 0}))
+	_ = zw.Close()
+	_ = f.Close()
+
+	h, err := NewHGTStore(dir, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 24.25° — четверть тайла от северного края → строка 900
+	v, meta, err := h.Height(ctx, 24.25, 55.1, 0)
+	if err != nil || math.Abs(v-900) > 1e-6 {
+		t.Fatalf("h=%v err=%v", v, err)
+	}
+	if meta.Name != "N24E055" || meta.GridSize != 1201 || meta.Source != "hgt:disk" {
+		t.Errorf("meta=%+v", meta)
+	}
+	if _, meta, _ = h.Height(ctx, 24.5, 55.5, 0); meta.Source != "hgt:mem-cache" {
+		t.Errorf("second lookup source=%q", meta.Source)
+	}
+
+	// пустота -32768 в центре тайла не должна попадать в интерполяцию
+	if v, _, err := h.Height(ctx, 24.5, 55.5, 0); err != nil || v < 0 {
+		t.Errorf("near void: h=%v err=%v", v, err)
+	}
+
+	v, meta, err = h.Height(ctx, -0.5, -0.5, 0)
+	if err != nil || math.Abs(v-600) > 1e-6 || meta.Name != "S01W001" {
+		t.Errorf("zip tile: h=%v meta=%+v err=%v", v, meta, err)
+	}
+
+	// северо-восточный угол мира берётся из N89E179, строка 0
+	if err := os.WriteFile(filepath.Join(dir, "N89E179.hgt"), hgtBytes(t, [2]int{600, 600}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if v, meta, err := h.Height(ctx, 90, 180, 0); err != nil || v != 0 || meta.Name != "N89E179" {
+		t.Errorf("world corner: h=%v meta=%+v err=%v", v, meta, err)
+	}
+
+	// zip-бомба: внутри больше, чем тайл SRTM1
+	f, err = os.Create(filepath.Join(dir, "N10E010.hgt.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw = zip.NewWriter(f)
+	zf, _ = zw.Create("N10E010.hgt")
+	_, _ = zf.Write(make([]byte, maxHGTSize+2))
+	_ = zw.Close()
+	_ = f.Close()
+	if _, _, err := h.Height(ctx, 10.5, 10.5, 0); err == nil || errors.Is(err, ErrTileNotFound) {
+		t.Errorf("oversized zip: err=%v", err)
+	}
+
+	if _, _, err := h.Height(ctx, 11.5, 10.5, 0); !errors.Is(err, ErrTileNotFound) {
+		t.Errorf("missing tile: err=%v", err)
+	}
+}
+
+func TestHGTStoreMissingTTLAndBudget(t *testing.T) {
+	dir := t.TempDir()
+	one := int64(1201 * 1201 * 4)
+	h, err := NewHGTStore(dir, 16, one+one/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, _, err := h.Height(ctx, 24.5, 55.5, 0); !errors.Is(err, ErrTileNotFound) {
+		t.Fatalf("err=%v", err)
+	}
+
+	// тайл появился в каталоге: пока отрицательный кэш жив — не видим
+	for _, n := range []string{"N24E055.hgt", "N24E056.hgt"} {
+		if err := os.WriteFile(filepath.Join(dir, n), hgtBytes(t, [2]int{0, 0}), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := h.Height(ctx, 24.5, 55.5, 0); !errors.Is(err, ErrTileNotFound) {
+		t.Errorf("within ttl: err=%v", err)
+	}
+	h.mu.Lock()
+	h.missing["N24E055"] = time.Now().Add(-missingTTL - time.Second)
+	h.mu.Unlock()
+	if _, _, err := h.Height(ctx, 24.5, 55.5, 0); err != nil {
+		t.Errorf("after ttl: err=%v", err)
+	}
+
+	// в бюджет помещается один тайл
+	if _, _, err := h.Height(ctx, 24.5, 56.5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if st := h.Stats(); st.Entries != 1 || st.Bytes > one+one/2 || st.Evictions != 1 {
+		t.Errorf("stats=%+v", st)
+	}
+}
@@ -0,0 +1,125 @@
+package ddm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Interp — метод интерполяции высоты между узлами сетки.
+type Interp string
+
+const (
+	InterpNearest  Interp = "nearest"
+	InterpBilinear Interp = "bilinear"
+	InterpBicubic  Interp = "bicubic" // Catmull-Rom по 16 узлам
+	InterpIDW      Interp = "idw"     // обратные квадраты расстояний по валидным углам ячейки
+)
+
+func ParseInterp(s string) (Interp, error) {
+	switch m := Interp(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return InterpBilinear, nil
+	case InterpNearest, InterpBilinear, InterpBicubic, InterpIDW:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown interpolation %q (nearest|bilinear|bicubic|idw)", s)
+	}
+}
+
+type interpKey struct{}
+
+// WithInterp переопределяет метод интерполяции для запросов с этим контекстом.
+func WithInterp(ctx context.Context, m Interp) context.Context {
+	return context.WithValue(ctx, interpKey{}, m)
+}
+
+func interpFrom(ctx context.Context, def Interp) Interp {
+	if m, ok := ctx.Value(interpKey{}).(Interp); ok && m != "" {
+		return m
+	}
+	if def == "" {
+		return InterpBilinear
+	}
+	return def
+}
+
+// interpolate считает высоту в ячейке (i,j)+(fx,fy) запрошенным методом.
+// Если рядом nodata, метод деградирует: bicubic → bilinear → idw, nearest → idw.
+// Возвращает метод, который реально дал значение.
+func interpolate(m Interp, i, j int, fx, fy float64, node nodeFunc) (float64, Interp, bool) {
+	switch m {
+	case InterpNearest:
+		if v, ok := node(i+int(math.Round(fy)), j+int(math.Round(fx))); ok {
+			return float64(v), InterpNearest, true
+		}
+		return idw(i, j, fx, fy, node)
+	case InterpIDW:
+		return idw(i, j, fx, fy, node)
+	case InterpBicubic:
+		if v, ok := bicubic(i, j, fx, fy, node); ok {
+			return v, InterpBicubic, true
+		}
+	}
+	if v, ok := bilinear(i, j, fx, fy, node); ok {
+		return v, InterpBilinear, true
+	}
+	return idw(i, j, fx, fy, node)
+}
+
+// bilinear по ячейке (i,j)-(i+1,j+1); false, если хоть один угол nodata.
+func bilinear(i, j int, fx, fy float64, node nodeFunc) (float64, bool) {
+	p00, ok00 := node(i, j)
+	p10, ok10 := node(i, j+1)
+	p01, ok01 := node(i+1, j)
+	p11, ok11 := node(i+1, j+1)
+	if !(ok00 && ok10 && ok01 && ok11) {
+		return 0, false
+	}
+	a := (1-fx)*float64(p00) + fx*float64(p10)
+	b := (1-fx)*float64(p01) + fx*float64(p11)
+	return (1-fy)*a + fy*b, true
+}
+
+// bicubic — Catmull-Rom по узлам (i-1..i+2, j-1..j+2); false, если хоть один nodata.
+func bicubic(i, j int, fx, fy float64, node nodeFunc) (float64, bool) {
+	var col [4]float64
+	for r := -1; r <= 2; r++ {
+		var row [4]float64
+		for c := -1; c <= 2; c++ {
+			v, ok := node(i+r, j+c)
+			if !ok {
+				return 0, false
+			}
+			row[c+1] = float64(v)
+		}
+		col[r+1] = catmullRom(row, fx)
+	}
+	return catmullRom(col, fy), true
+}
+
+func catmullRom(p [4]float64, t float64) float64 {
+	return p[1] + 0.5*t*(p[2]-p[0]+t*(2*p[0]-5*p[1]+4*p[2]-p[3]+t*(3*(p[1]-p[2])+p[3]-p[0])))
+}
+
+// idw — по валидным углам ячейки с весами 1/d²; точно в узле — его значение.
+func idw(i, j int, fx, fy float64, node nodeFunc) (float64, Interp, bool) {
+	var sum, wsum float64
+	for _, c := range [4][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}} {
+		v, ok := node(i+c[0], j+c[1])
+		if !ok {
+			continue
+		}
+		d2 := (fy-float64(c[0]))*(fy-float64(c[0])) + (fx-float64(c[1]))*(fx-float64(c[1]))
+		if d2 < 1e-12 {
+			return float64(v), InterpIDW, true
+		}
+		sum += float64(v) / d2
+		wsum += 1 / d2
+	}
+	if wsum == 0 {
+		return 0, InterpIDW, false
+	}
+	return sum / wsum, InterpIDW, true
+}
@@ -0,0 +1,90 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+// gridNodes — узлы f(i,j) на сетке 6x6 с дырками в void.
+func gridNodes(f func(i, j int) float64, void ...[2]int) nodeFunc {
+	return func(i, j int) (float32, bool) {
+		i, j = min(max(i, 0), 5), min(max(j, 0), 5)
+		for _, v := range void {
+			if v[0] == i && v[1] == j {
+				return -32768, false
+			}
+		}
+		return float32(f(i, j)), true
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	quad := func(i, j int) float64 { return float64(i*i) + 3*float64(j) }
+
+	cases := []struct {
+		name   string
+		m      Interp
+		node   nodeFunc
+		fx, fy float64
+		want   float64
+		used   Interp
+	}{
+		{"nearest", InterpNearest, gridNodes(quad), 0.6, 0.4, quad(2, 3), InterpNearest},
+		{"bilinear", InterpBilinear, gridNodes(quad), 0.5, 0.5, (4 + 9 + 6 + 9) / 2.0, InterpBilinear},
+		// Catmull-Rom точен для квадратичных: (2.5)² + 3*2.5
+		{"bicubic", InterpBicubic, gridNodes(quad), 0.5, 0.5, 6.25 + 7.5, InterpBicubic},
+		// дырка во внешнем кольце 4x4 — откат на bilinear
+		{"bicubic→bilinear", InterpBicubic, gridNodes(quad, [2]int{1, 1}), 0.5, 0.5, (4 + 9 + 6 + 9) / 2.0, InterpBilinear},
+		// дырка в углу ячейки — idw по трём оставшимся
+		{"bilinear→idw", InterpBilinear, gridNodes(quad, [2]int{3, 3}), 0.5, 0.5, (quad(2, 2) + quad(2, 3) + quad(3, 2)) / 3, InterpIDW},
+		{"nearest→idw", InterpNearest, gridNodes(quad, [2]int{2, 3}), 0.9, 0.1, 0, InterpIDW},
+		{"idw at node", InterpIDW, gridNodes(quad), 0, 0, quad(2, 2), InterpIDW},
+	}
+	for _, tc := range cases {
+		v, used, ok := interpolate(tc.m, 2, 2, tc.fx, tc.fy, tc.node)
+		if !ok || used != tc.used || (tc.want != 0 && math.Abs(v-tc.want) > 1e-4) {
+			t.Errorf("%s: v=%v used=%s ok=%v, want %v via %s", tc.name, v, used, ok, tc.want, tc.used)
+		}
+	}
+
+	allVoid := func(int, int) (float32, bool) { return 0, false }
+	if _, _, ok := interpolate(InterpBicubic, 2, 2, 0.5, 0.5, allVoid); ok {
+		t.Error("all nodata must fail")
+	}
+	if _, err := ParseInterp("spline"); err == nil {
+		t.Error("expected unknown interpolation error")
+	}
+}
+
+func TestHandleHeightInterp(t *testing.T) {
+	s := newTestStore(t)
+	x, y := tileXYZ(24.05, 55.78, 10)
+	writeTile(t, s, 10, x, y, 9, func(i, j int) float32 { return float32(i*i + j) })
+	srv := &Server{Store: s}
+
+	w := httptest.NewRecorder()
+	srv.HandleHeight(w, httptest.NewRequest("GET", "/height?lat=24.05&lon=55.78&interp=bicubic", nil))
+	var resp map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	// соседей у тайла нет — у края bicubic может откатиться, но метод всегда указан
+	if resp["interp"] != "bicubic" && resp["interp"] != "bilinear" {
+		t.Errorf("interp %v", resp["interp"])
+	}
+
+	w = httptest.NewRecorder()
+	srv.HandleHeight(w, httptest.NewRequest("GET", "/height?lat=24.05&lon=55.78&interp=spline", nil))
+	if w.Code != 400 {
+		t.Errorf("bad interp: %d", w.Code)
+	}
+
+	h1, m1, _ := s.Height(WithInterp(context.Background(), InterpNearest), 24.05, 55.78, 10)
+	h2, m2, _ := s.Height(context.Background(), 24.05, 55.78, 10)
+	if m1.Interp != InterpNearest || m2.Interp != InterpBilinear || h1 != math.Round(h1) {
+		t.Errorf("nearest %v (%s), default %v (%s)", h1, m1.Interp, h2, m2.Interp)
+	}
+}
@@ -0,0 +1,362 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+const (
+	quatInt16Scale = 32767.0
+	maxRayDist     = 50000.0
+	maxJSONBody    = 1 << 20 // POST-тело с позой камеры или трассой
+)
+
+// Параметры запроса /intersection. Приходят либо query-строкой, либо JSON-телом.
+type intersectionRequest struct {
+	Lat     float64   `json:"lat"`
+	Lon     float64   `json:"lon"`
+	Alt     float64   `json:"alt"` // эллипсоид WGS84, как отдаёт GPS
+	Q       []float64 `json:"q"`   // w,x,y,z
+	QFormat string    `json:"q_format"`
+	Step    float64   `json:"step"`
+	MaxDist float64   `json:"max_dist"`
+	Z       int       `json:"z"`
+
+	Gimbal gimbalRequest `json:"gimbal"`
+	Mount  mountRequest  `json:"mount"`
+}
+
+type gimbalRequest struct {
+	Roll       float64   `json:"roll"` // градусы
+	Pitch      float64   `json:"pitch"`
+	Yaw        float64   `json:"yaw"`
+	Q          []float64 `json:"q"`           // вместо углов: кватернион w,x,y,z
+	EarthFrame bool      `json:"earth_frame"` // углы относительно горизонта, а не корпуса
+}
+
+type mountRequest struct {
+	Roll     float64   `json:"roll"` // монтажный разворот, градусы
+	Pitch    float64   `json:"pitch"`
+	Yaw      float64   `json:"yaw"`
+	LeverArm []float64 `json:"lever_arm"` // смещение камеры от антенны GPS, FRD, м
+}
+
+func (s *Server) HandleIntersection(w http.ResponseWriter, r *http.Request) {
+	req, err := parseIntersectionRequest(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	params, err := s.raycastParams(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	res, err := terrain.Trace(ctx, params)
+	if err != nil && !errors.Is(err, terrain.ErrUnknownTerrain) {
+		http.Error(w, "raycast failed: "+err.Error(), terrainErrorStatus(err))
+		return
+	}
+	resp := rayResponse(res, err)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// rayResponse — общий вид результата трассировки. Если данные рельефа
+// кончились по пути, отдаём где именно ("unknown") вместо выдуманного пересечения.
+func rayResponse(res terrain.RaycastResult, err error) map[string]any {
+	resp := map[string]any{
+		"hit": res.Hit,
+		"lat": res.Lat,
+		"lon": res.Lon,
+		"alt": res.Alt,
+	}
+	if res.Hit {
+		resp["ground"] = res.Ground
+		resp["range"] = res.Range
+	}
+	if res.Unknown {
+		resp["unknown"] = true
+		resp["range"] = res.Range
+		if err != nil {
+			resp["error"] = err.Error()
+		}
+	}
+	return resp
+}
+
+// terrainErrorStatus — код ответа для ошибки источника высот (не «нет данных»).
+func terrainErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// raycastParams проверяет запрос и собирает параметры трассировки поверх источника высот.
+func (s *Server) raycastParams(req *intersectionRequest) (terrain.RaycastParams, error) {
+	if req.Z <= 0 {
+		req.Z = s.defaultZoom()
+	}
+	q, err := req.quat()
+	if err != nil {
+		return terrain.RaycastParams{}, err
+	}
+	if err := req.validate(); err != nil {
+		return terrain.RaycastParams{}, err
+	}
+	mount, err := req.mount()
+	if err != nil {
+		return terrain.RaycastParams{}, err
+	}
+	return terrain.RaycastParams{
+		CamLon:  req.Lon,
+		CamLat:  req.Lat,
+		CamAlt:  req.Alt,
+		Quat:    q,
+		Step:    req.Step,
+		MaxDist: req.MaxDist,
+		Mount:   mount,
+		DEM: &DEMAdapter{
+			Source:  s.backend(),
+			Zoom:    req.Z,
+			Timeout: 5 * time.Second,
+		},
+	}, nil
+}
+
+func newIntersectionRequest() *intersectionRequest {
+	return &intersectionRequest{Step: 1, MaxDist: 3000}
+}
+
+func parseIntersectionRequest(w http.ResponseWriter, r *http.Request) (*intersectionRequest, error) {
+	req := newIntersectionRequest()
+	if r.Method == http.MethodPost {
+		if err := decodeJSONBody(w, r, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	if err := req.parseQuery(r.URL.Query()); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// decodeJSONBody читает JSON-тело не длиннее maxJSONBody, лишние поля — ошибка.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) error {
+	return decodeJSONBodyLimit(w, r, v, maxJSONBody)
+}
+
+// decodeJSONBodyLimit — то же с другим пределом, для тел со списками точек.
+func decodeJSONBodyLimit(w http.ResponseWriter, r *http.Request, v any, limit int64) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid json body: %w", err)
+	}
+	return nil
+}
+
+// bodyErrorStatus — 413 для слишком длинного тела, иначе 400.
+func bodyErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// parseQuery — общие для /intersection и производных эндпоинтов параметры позы камеры.
+func (req *intersectionRequest) parseQuery(q url.Values) error {
+	var err error
+	if req.Lat, err = queryFloat(q.Get("lat")); err != nil {
+		return fmt.Errorf("invalid lat")
+	}
+	if req.Lon, err = queryFloat(q.Get("lon")); err != nil {
+		return fmt.Errorf("invalid lon")
+	}
+	if req.Alt, err = queryFloat(q.Get("alt")); err != nil {
+		return fmt.Errorf("invalid alt")
+	}
+	// кватернион: q=w,x,y,z либо qw/qx/qy/qz по отдельности
+	if v := q.Get("q"); v != "" {
+		if req.Q, err = queryFloatList(v); err != nil {
+			return fmt.Errorf("invalid q")
+		}
+	} else {
+		for _, k := range []string{"qw", "qx", "qy", "qz"} {
+			f, err := queryFloat(q.Get(k))
+			if err != nil {
+				return fmt.Errorf("invalid %s", k)
+			}
+			req.Q = append(req.Q, f)
+		}
+	}
+	req.QFormat = q.Get("q_format")
+	if v := q.Get("step"); v != "" {
+		if req.Step, err = queryFloat(v); err != nil {
+			return fmt.Errorf("invalid step")
+		}
+	}
+	if v := q.Get("max_dist"); v != "" {
+		if req.MaxDist, err = queryFloat(v); err != nil {
+			return fmt.Errorf("invalid max_dist")
+		}
+	}
+	if v := q.Get("z"); v != "" {
+		if req.Z, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("invalid z")
+		}
+	}
+	return req.parseMountQuery(q)
+}
+
+// parseMountQuery — gimbal_roll/pitch/yaw или gimbal_q, gimbal_earth,
+// mount_roll/pitch/yaw и lever_arm=x,y,z.
+func (req *intersectionRequest) parseMountQuery(q url.Values) error {
+	floats := []struct {
+		key string
+		dst *float64
+	}{
+		{"gimbal_roll", &req.Gimbal.Roll}, {"gimbal_pitch", &req.Gimbal.Pitch}, {"gimbal_yaw", &req.Gimbal.Yaw},
+		{"mount_roll", &req.Mount.Roll}, {"mount_pitch", &req.Mount.Pitch}, {"mount_yaw", &req.Mount.Yaw},
+	}
+	var err error
+	for _, f := range floats {
+		if v := q.Get(f.key); v != "" {
+			if *f.dst, err = queryFloat(v); err != nil {
+				return fmt.Errorf("invalid %s", f.key)
+			}
+		}
+	}
+	if v := q.Get("gimbal_earth"); v != "" {
+		if req.Gimbal.EarthFrame, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid gimbal_earth")
+		}
+	}
+	if req.Gimbal.Q, err = queryFloatList(q.Get("gimbal_q")); err != nil {
+		return fmt.Errorf("invalid gimbal_q")
+	}
+	if req.Mount.LeverArm, err = queryFloatList(q.Get("lever_arm")); err != nil {
+		return fmt.Errorf("invalid lever_arm")
+	}
+	return nil
+}
+
+func (req *intersectionRequest) mount() (terrain.Mount, error) {
+	m := terrain.Mount{
+		GimbalEuler: [3]float64{req.Gimbal.Roll, req.Gimbal.Pitch, req.Gimbal.Yaw},
+		EarthFrame:  req.Gimbal.EarthFrame,
+		Offset:      [3]float64{req.Mount.Roll, req.Mount.Pitch, req.Mount.Yaw},
+	}
+	switch len(req.Gimbal.Q) {
+	case 0:
+	case 4:
+		copy(m.Gimbal[:], req.Gimbal.Q)
+	default:
+		return m, fmt.Errorf("gimbal q must have 4 components (w,x,y,z)")
+	}
+	switch len(req.Mount.LeverArm) {
+	case 0:
+	case 3:
+		copy(m.LeverArm[:], req.Mount.LeverArm)
+	default:
+		return m, fmt.Errorf("lever_arm must have 3 components (forward,right,down)")
+	}
+	return m, nil
+}
+
+// quat приводит кватернион к float-форме. int16 — масштабированный вид из PX4 (×32767).
+func (req *intersectionRequest) quat() ([4]float64, error) {
+	var q [4]float64
+	if len(req.Q) != 4 {
+		return q, fmt.Errorf("q must have 4 components (w,x,y,z)")
+	}
+	limit := 1.0
+	switch req.QFormat {
+	case "", "float":
+	case "int16":
+		limit = quatInt16Scale + 1
+	default:
+		return q, fmt.Errorf("invalid q_format %q (float|int16)", req.QFormat)
+	}
+	var n float64
+	for i, v := range req.Q {
+		if math.IsNaN(v) || math.Abs(v) > limit {
+			return q, fmt.Errorf("q[%d] out of range", i)
+		}
+		q[i] = v
+		if req.QFormat == "int16" {
+			q[i] /= quatInt16Scale
+		}
+		n += q[i] * q[i]
+	}
+	if n < 1e-6 {
+		return q, fmt.Errorf("degenerate quaternion")
+	}
+	return q, nil
+}
+
+func (req *intersectionRequest) validate() error {
+	switch {
+	case req.Lat < -85 || req.Lat > 85:
+		return fmt.Errorf("lat out of range")
+	case req.Lon < -180 || req.Lon > 180:
+		return fmt.Errorf("lon out of range")
+	case math.IsNaN(req.Alt) || math.IsInf(req.Alt, 0):
+		return fmt.Errorf("invalid alt")
+	case req.Step <= 0 || req.Step > 1000:
+		return fmt.Errorf("step must be in (0, 1000]")
+	case req.MaxDist <= 0 || req.MaxDist > maxRayDist:
+		return fmt.Errorf("max_dist must be in (0, %g]", maxRayDist)
+	case req.Z < 0 || req.Z > 22:
+		return fmt.Errorf("z out of range")
+	}
+	if req.MaxDist/req.Step > 1e6 {
+		return fmt.Errorf("too many steps: max_dist/step > 1e6")
+	}
+	return nil
+}
+
+// queryFloatList разбирает "a,b,c"; пустая строка — пустой список.
+func queryFloatList(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []float64
+	for _, p := range strings.Split(s, ",") {
+		f, err := queryFloat(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func queryFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("not a finite number")
+	}
+	return f, nil
+}
@@ -0,0 +1,105 @@
+package ddm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleIntersection(t *testing.T) {
+	// камера в надир: тангаж -90°
+	c, s := math.Cos(-math.Pi/4), math.Sin(-math.Pi/4)
+	i16 := func(v float64) int { return int(math.Round(v * quatInt16Scale)) }
+	srv := &Server{Source: &stubBackend{h: 50, err: ErrNoData}}
+	call := func(r *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+		w := httptest.NewRecorder()
+		srv.HandleIntersection(w, r)
+		var resp map[string]any
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s: %v", r.URL, err)
+			}
+		}
+		return w, resp
+	}
+	get := func(q string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/intersection?"+q, nil)
+	}
+	post := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/intersection", strings.NewReader(body))
+	}
+
+	const pos = "lat=25.5&lon=55&alt=300"
+	for name, r := range map[string]*http.Request{
+		"q":        get(fmt.Sprintf("%s&q=%g,0,%g,0", pos, c, s)),
+		"qw..qz":   get(fmt.Sprintf("%s&qw=%g&qx=0&qy=%g&qz=0&step=0.5", pos, c, s)),
+		"int16":    get(fmt.Sprintf("%s&q=%d,0,%d,0&q_format=int16", pos, i16(c), i16(s))),
+		"json":     post(fmt.Sprintf(`{"lat":25.5,"lon":55,"alt":300,"q":[%g,0,%g,0],"max_dist":1000}`, c, s)),
+		"json i16": post(fmt.Sprintf(`{"lat":25.5,"lon":55,"alt":300,"q":[%d,0,%d,0],"q_format":"int16"}`, i16(c), i16(s))),
+	} {
+		w, resp := call(r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: code=%d body=%s", name, w.Code, w.Body)
+			continue
+		}
+		if resp["hit"] != true || resp["ground"] != 50.0 ||
+			math.Abs(resp["lat"].(float64)-25.5) > 1e-5 || math.Abs(resp["lon"].(float64)-55) > 1e-5 {
+			t.Errorf("%s: resp=%v", name, resp)
+		}
+	}
+
+	// южнее 25° у источника нет данных: луч упирается в неизвестный рельеф
+	w, resp := call(get(fmt.Sprintf("lat=24.5&lon=55&alt=300&q=%g,0,%g,0", c, s)))
+	if w.Code != http.StatusOK || resp["hit"] != false || resp["unknown"] != true {
+		t.Errorf("unknown terrain: code=%d resp=%v", w.Code, resp)
+	}
+
+	nadir := fmt.Sprintf("q=%g,0,%g,0", c, s)
+	for _, q := range []string{
+		"lon=55&alt=300&" + nadir,
+		"lat=NaN&lon=55&alt=300&" + nadir,
+		"lat=89&lon=55&alt=300&" + nadir,
+		pos,
+		pos + "&qw=1&qx=0&qy=0",
+		pos + "&q=1,0,0",
+		pos + "&q=0,0,0,0",
+		pos + "&q=2,0,0,0",
+		pos + "&q=40000,0,0,0&q_format=int16",
+		pos + "&" + nadir + "&q_format=double",
+		pos + "&" + nadir + "&step=0",
+		pos + "&" + nadir + "&max_dist=100000",
+		pos + "&" + nadir + "&step=0.001&max_dist=5000",
+		pos + "&" + nadir + "&z=30",
+		pos + "&" + nadir + "&lever_arm=1,2",
+	} {
+		if w, _ := call(get(q)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code=%d, want 400", q, w.Code)
+		}
+	}
+	for _, body := range []string{
+		`{"lat":25.5,"lon":55,"alt":300,"q":[1,0,0,0],"roll":1}`,
+		`{"lat":25.5,"lon":55,"alt":300,"q":[1,0,0]}`,
+		`{"lat":25.5,"lon":55,`,
+	} {
+		if w, _ := call(post(body)); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code=%d, want 400", body, w.Code)
+		}
+	}
+
+	// тело больше maxJSONBody — 413, даже если это валидный JSON
+	huge := `{"lat":25.5,"lon":55,"alt":300,"q":[1,0,0,0]` + strings.Repeat(" ", maxJSONBody) + `}`
+	if w, _ := call(post(huge)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("huge body: code=%d, want 413", w.Code)
+	}
+
+	// прочие ошибки источника — 502
+	srv.Source = &stubBackend{h: 50, err: errors.New("upstream 500")}
+	if w, _ := call(get(fmt.Sprintf("lat=24.5&lon=55&alt=300&q=%g,0,%g,0", c, s))); w.Code != http.StatusBadGateway {
+		t.Errorf("source error: code=%d body=%s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,190 @@
+package ddm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BBox — охват слоя в градусах.
+type BBox struct {
+	South, West, North, East float64
+}
+
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.South && lat <= b.North && lon >= b.West && lon <= b.East
+}
+
+// Layer — один источник в составном бэкенде. BBox == nil — без ограничения охвата.
+type Layer struct {
+	Name    string
+	Backend Backend
+	BBox    *BBox
+}
+
+func (l Layer) covers(lat, lon float64) bool {
+	return l.BBox == nil || l.BBox.Contains(lat, lon)
+}
+
+// Composite опрашивает слои по порядку (первый — самый приоритетный) и
+// переходит к следующему, если текущий не покрывает точку или вернул
+// ErrNoData / ErrTileNotFound. Meta.Source получает префикс "слой:".
+type Composite struct {
+	Layers []Layer
+}
+
+// fallThrough — ошибки, после которых имеет смысл спросить следующий слой.
+func fallThrough(err error) bool {
+	return errors.Is(err, ErrNoData) || errors.Is(err, ErrTileNotFound)
+}
+
+func (c *Composite) Height(ctx context.Context, lat, lon float64, z int) (float64, Meta, error) {
+	var (
+		lastMeta Meta
+		lastErr  error
+	)
+	for _, l := range c.Layers {
+		if !l.covers(lat, lon) {
+			continue
+		}
+		h, meta, err := l.Backend.Height(ctx, lat, lon, z)
+		meta.Source = l.Name + ":" + meta.Source
+		if err == nil || !fallThrough(err) {
+			return h, meta, err
+		}
+		lastMeta, lastErr = meta, err
+	}
+	if lastErr == nil {
+		return 0, Meta{}, fmt.Errorf("%w: no layer covers %.6f,%.6f", ErrTileNotFound, lat, lon)
+	}
+	return 0, lastMeta, lastErr
+}
+
+// HeightBatch отдаёт каждому слою батчем только те точки, которые
+// не разрешились на предыдущих слоях.
+func (c *Composite) HeightBatch(ctx context.Context, pts []LatLon, z int) []PointResult {
+	out := make([]PointResult, len(pts))
+	pending := make([]int, len(pts))
+	for i := range pts {
+		pending[i] = i
+		out[i].Err = fmt.Errorf("%w: no layer covers %.6f,%.6f", ErrTileNotFound, pts[i].Lat, pts[i].Lon)
+	}
+
+	for _, l := range c.Layers {
+		if len(pending) == 0 {
+			break
+		}
+		var idx []int
+		var sub []LatLon
+		var rest []int
+		for _, i := range pending {
+			if l.covers(pts[i].Lat, pts[i].Lon) {
+				idx = append(idx, i)
+				sub = append(sub, pts[i])
+			} else {
+				rest = append(rest, i)
+			}
+		}
+		if len(sub) == 0 {
+			continue
+		}
+		for k, r := range l.Backend.HeightBatch(ctx, sub, z) {
+			i := idx[k]
+			r.Meta.Source = l.Name + ":" + r.Meta.Source
+			out[i] = r
+			if r.Err != nil && fallThrough(r.Err) {
+				rest = append(rest, i)
+			}
+		}
+		pending = rest
+	}
+	return out
+}
+
+// LayerSpec — разобранное описание слоя: [имя=]тип[:аргумент][@юг,запад,север,восток].
+type LayerSpec struct {
+	Name string
+	Kind string
+	Arg  string
+	BBox *BBox
+}
+
+// ParseLayers разбирает список слоёв через ";", например
+// "survey=geotiff:/data/survey.tif@24.9,55.6,25.1,55.9;ddm;srtm=hgt:./srtm".
+func ParseLayers(s string) ([]LayerSpec, error) {
+	var out []LayerSpec
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var sp LayerSpec
+		// "@" в пути к файлу допустим: охват — только хвост из чисел через запятую
+		if at := strings.LastIndex(part, "@"); at >= 0 && looksLikeBBox(part[at+1:]) {
+			bb, err := ParseBBox(part[at+1:])
+			if err != nil {
+				return nil, fmt.Errorf("layer %q: %w", part, err)
+			}
+			sp.BBox = &bb
+			part = part[:at]
+		}
+		if eq := strings.Index(part, "="); eq >= 0 && !strings.Contains(part[:eq], ":") {
+			sp.Name, part = strings.TrimSpace(part[:eq]), part[eq+1:]
+		}
+		sp.Kind, sp.Arg, _ = strings.Cut(part, ":")
+		sp.Kind = strings.TrimSpace(sp.Kind)
+		if sp.Kind == "" {
+			return nil, fmt.Errorf("layer %q: empty type", part)
+		}
+		if sp.Name == "" {
+			sp.Name = sp.Kind
+		}
+		out = append(out, sp)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no layers")
+	}
+	return out, nil
+}
+
+// looksLikeBBox: хвост после "@" из чисел через запятую. Неверное их число
+// или порядок — ошибка в ParseBBox, а не часть пути.
+func looksLikeBBox(s string) bool {
+	f := strings.Split(s, ",")
+	if len(f) < 2 {
+		return false
+	}
+	for _, p := range f {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(p), 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseBBox разбирает "юг,запад,север,восток" в градусах.
+func ParseBBox(s string) (BBox, error) {
+	f := strings.Split(s, ",")
+	if len(f) != 4 {
+		return BBox{}, fmt.Errorf("bbox needs south,west,north,east: %q", s)
+	}
+	var v [4]float64
+	for i, p := range f {
+		x, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BBox{}, fmt.Errorf("bbox: %w", err)
+		}
+		v[i] = x
+	}
+	b := BBox{South: v[0], West: v[1], North: v[2], East: v[3]}
+	if !b.valid() {
+		return BBox{}, fmt.Errorf("bbox out of range: %q", s)
+	}
+	return b, nil
+}
+
+func (b BBox) valid() bool {
+	return b.South <= b.North && b.West <= b.East && b.South >= -90 && b.North <= 90 && b.West >= -180 && b.East <= 180
+}
@@ -0,0 +1,117 @@
+package ddm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// stubBackend отдаёт константу к северу от 25° и err южнее.
+type stubBackend struct {
+	h     float64
+	err   error
+	calls int
+}
+
+func (b *stubBackend) Height(_ context.Context, lat, _ float64, _ int) (float64, Meta, error) {
+	b.calls++
+	if lat < 25 {
+		return 0, Meta{Source: "stub"}, b.err
+	}
+	return b.h, Meta{Source: "stub"}, nil
+}
+
+func (b *stubBackend) HeightBatch(ctx context.Context, pts []LatLon, z int) []PointResult {
+	out := make([]PointResult, len(pts))
+	for i, p := range pts {
+		out[i].Height, out[i].Meta, out[i].Err = b.Height(ctx, p.Lat, p.Lon, z)
+	}
+	return out
+}
+
+func TestCompositeFallThrough(t *testing.T) {
+	survey := &stubBackend{h: 10, err: ErrNoData}
+	tiles := &stubBackend{h: 20, err: ErrTileNotFound}
+	srtm := &stubBackend{h: 30, err: ErrNoData}
+	c := &Composite{Layers: []Layer{
+		{Name: "survey", Backend: survey, BBox: &BBox{South: 24, West: 55, North: 26, East: 56}},
+		{Name: "ddm", Backend: tiles},
+		{Name: "srtm", Backend: srtm, BBox: &BBox{South: 20, West: 50, North: 30, East: 60}},
+	}}
+	ctx := context.Background()
+
+	cases := []struct {
+		lat, lon float64
+		h        float64
+		src      string
+		err      error
+	}{
+		{25.5, 55.5, 10, "survey:stub", nil},         // съёмка покрывает
+		{25.5, 57.0, 20, "ddm:stub", nil},            // вне bbox съёмки
+		{24.5, 55.5, 0, "srtm:stub", ErrNoData},      // никто не дал значения — последняя ошибка
+		{24.5, 70.0, 0, "ddm:stub", ErrTileNotFound}, // srtm не покрывает
+	}
+	for _, tc := range cases {
+		h, meta, err := c.Height(ctx, tc.lat, tc.lon, 0)
+		if h != tc.h || meta.Source != tc.src || !errors.Is(err, tc.err) || (tc.err == nil) != (err == nil) {
+			t.Errorf("%v,%v: h=%v src=%q err=%v", tc.lat, tc.lon, h, meta.Source, err)
+		}
+	}
+
+	// не nodata/not-found — дальше не идём
+	boom := errors.New("boom")
+	c.Layers[0].Backend = &stubBackend{err: boom}
+	if _, meta, err := c.Height(ctx, 24.5, 55.5, 0); !errors.Is(err, boom) || meta.Source != "survey:stub" {
+		t.Errorf("hard error: src=%q err=%v", meta.Source, err)
+	}
+
+	c.Layers[0].Backend = survey
+	res := c.HeightBatch(ctx, []LatLon{{25.5, 55.5}, {25.5, 57}, {24.5, 55.5}, {-80, 0}}, 0)
+	want := []string{"survey:stub", "ddm:stub", "srtm:stub", "ddm:stub"}
+	for i, r := range res {
+		if r.Meta.Source != want[i] {
+			t.Errorf("batch %d: src=%q err=%v", i, r.Meta.Source, r.Err)
+		}
+	}
+	if res[0].Height != 10 || res[1].Height != 20 || res[2].Err == nil || res[3].Err == nil {
+		t.Errorf("batch: %+v", res)
+	}
+}
+
+func TestParseLayers(t *testing.T) {
+	specs, err := ParseLayers("survey=geotiff:/data/a=b.tif@24.9,55.6,25.1,55.9; ddm ;hgt:./srtm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 3 {
+		t.Fatalf("got %d layers", len(specs))
+	}
+	if s := specs[0]; s.Name != "survey" || s.Kind != "geotiff" || s.Arg != "/data/a=b.tif" || s.BBox == nil || s.BBox.North != 25.1 {
+		t.Errorf("layer 0: %+v", s)
+	}
+	if s := specs[1]; s.Name != "ddm" || s.Kind != "ddm" || s.BBox != nil {
+		t.Errorf("layer 1: %+v", s)
+	}
+	if s := specs[2]; s.Name != "hgt" || s.Arg != "./srtm" {
+		t.Errorf("layer 2: %+v", s)
+	}
+	// "@" в имени файла — не охват
+	specs, err = ParseLayers("geotiff:/data/a@b.tif;hgt:/srv/dem@2x,old;geotiff:/d/x@1.tif@24.9,55.6,25.1,55.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := specs[0]; s.Arg != "/data/a@b.tif" || s.BBox != nil {
+		t.Errorf("path with @: %+v", s)
+	}
+	if s := specs[1]; s.Arg != "/srv/dem@2x,old" || s.BBox != nil {
+		t.Errorf("path with @ and comma: %+v", s)
+	}
+	if s := specs[2]; s.Arg != "/d/x@1.tif" || s.BBox == nil || s.BBox.West != 55.6 {
+		t.Errorf("path with @ and bbox: %+v", s)
+	}
+	for _, bad := range []string{"", "ddm@1,2,3", "ddm@30,0,20,10", "ddm@1,2,3,4,5", "=:x"} {
+		if _, err := ParseLayers(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
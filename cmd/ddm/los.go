@@ -0,0 +1,190 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+type losEndpoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+	Alt float64 `json:"alt"` // MSL, либо над землёй при AGL
+	AGL bool    `json:"agl"`
+}
+
+type losRequest struct {
+	From       losEndpoint `json:"from"`
+	To         losEndpoint `json:"to"`
+	Step       float64     `json:"step"`
+	Curvature  bool        `json:"curvature"`
+	Refraction *float64    `json:"k"`
+	Z          int         `json:"z"`
+}
+
+// HandleLOS: GET ?from_lat=&from_lon=&from_alt=&from_agl=&to_lat=...&curvature=1&k=0.25
+// либо POST {"from":{...},"to":{...},"step":10,"curvature":true,"k":0.25}.
+// k по умолчанию — радио (terrain.DefaultRefraction), для оптики передавайте k=0.13.
+func (s *Server) HandleLOS(w http.ResponseWriter, r *http.Request) {
+	req, err := parseLOSRequest(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	for _, e := range []losEndpoint{req.From, req.To} {
+		if e.Lat < minLat || e.Lat > maxLat || e.Lon < -180 || e.Lon > 180 {
+			http.Error(w, "coordinates out of range", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Step < 0 || req.Step > 1000 {
+		http.Error(w, "step must be in [0, 1000]", http.StatusBadRequest)
+		return
+	}
+	if req.Refraction != nil && (*req.Refraction < 0 || *req.Refraction >= 1) {
+		http.Error(w, "k must be in [0, 1)", http.StatusBadRequest)
+		return
+	}
+	if req.Z <= 0 {
+		req.Z = s.defaultZoom()
+	}
+	if req.Z > 22 {
+		http.Error(w, "z out of range", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	// AGL → MSL по рельефу в конечной точке
+	for _, e := range []*losEndpoint{&req.From, &req.To} {
+		if !e.AGL {
+			continue
+		}
+		h, _, err := s.backend().Height(ctx, e.Lat, e.Lon, req.Z)
+		if errors.Is(err, ErrNoData) || errors.Is(err, ErrTileNotFound) {
+			http.Error(w, "no terrain data for agl endpoint: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			http.Error(w, "height lookup failed: "+err.Error(), terrainErrorStatus(err))
+			return
+		}
+		e.Alt += h
+	}
+
+	k := terrain.DefaultRefraction
+	if req.Refraction != nil {
+		k = *req.Refraction
+	}
+	res, err := terrain.LineOfSight(ctx, terrain.LOSParams{
+		FromLat: req.From.Lat, FromLon: req.From.Lon, FromAlt: req.From.Alt,
+		ToLat: req.To.Lat, ToLon: req.To.Lon, ToAlt: req.To.Alt,
+		DEM:        &DEMAdapter{Source: s.backend(), Zoom: req.Z, Timeout: 5 * time.Second},
+		Step:       req.Step,
+		Curvature:  req.Curvature,
+		Refraction: k,
+	})
+	if errors.Is(err, terrain.ErrTooManySamples) {
+		http.Error(w, err.Error()+", increase step", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, terrain.ErrUnknownTerrain) {
+		http.Error(w, "unknown terrain along path: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "line of sight failed: "+err.Error(), terrainErrorStatus(err))
+		return
+	}
+
+	resp := map[string]any{
+		"visible":   res.Visible,
+		"distance":  res.Distance,
+		"from_alt":  req.From.Alt,
+		"to_alt":    req.To.Alt,
+		"clearance": nil,
+	}
+	if res.Distance > 0 && !math.IsInf(res.Clearance, 1) {
+		resp["clearance"] = map[string]any{
+			"margin": res.Clearance,
+			"lat":    res.ClearanceLat,
+			"lon":    res.ClearanceLon,
+			"dist":   res.ClearanceDist,
+		}
+	}
+	if !res.Visible {
+		resp["obstruction"] = map[string]any{
+			"lat":    res.BlockLat,
+			"lon":    res.BlockLon,
+			"dist":   res.BlockDist,
+			"ground": res.BlockGround,
+			"alt":    res.BlockAlt,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func parseLOSRequest(w http.ResponseWriter, r *http.Request) (*losRequest, error) {
+	req := &losRequest{}
+	if r.Method == http.MethodPost {
+		if err := decodeJSONBody(w, r, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	q := r.URL.Query()
+	floats := []struct {
+		key string
+		dst *float64
+	}{
+		{"from_lat", &req.From.Lat}, {"from_lon", &req.From.Lon}, {"from_alt", &req.From.Alt},
+		{"to_lat", &req.To.Lat}, {"to_lon", &req.To.Lon}, {"to_alt", &req.To.Alt},
+	}
+	var err error
+	for _, f := range floats {
+		if *f.dst, err = queryFloat(q.Get(f.key)); err != nil {
+			return nil, fmt.Errorf("invalid %s", f.key)
+		}
+	}
+	bools := []struct {
+		key string
+		dst *bool
+	}{
+		{"from_agl", &req.From.AGL}, {"to_agl", &req.To.AGL}, {"curvature", &req.Curvature},
+	}
+	for _, b := range bools {
+		if v := q.Get(b.key); v != "" {
+			if *b.dst, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("invalid %s", b.key)
+			}
+		}
+	}
+	if v := q.Get("step"); v != "" {
+		if req.Step, err = queryFloat(v); err != nil {
+			return nil, fmt.Errorf("invalid step")
+		}
+	}
+	if v := q.Get("k"); v != "" {
+		k, err := queryFloat(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid k")
+		}
+		req.Refraction = &k
+	}
+	if v := q.Get("z"); v != "" {
+		if req.Z, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid z")
+		}
+	}
+	return req, nil
+}
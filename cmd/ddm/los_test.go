@@ -0,0 +1,61 @@
+package ddm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleLOS(t *testing.T) {
+	srv := &Server{Source: &stubBackend{h: 50}}
+	get := func(q string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.HandleLOS(w, httptest.NewRequest(http.MethodGet, "/los?"+q, nil))
+		return w
+	}
+
+	w := get("from_lat=30&from_lon=179.99&from_alt=10&from_agl=1&to_lat=30&to_lon=-179.99&to_alt=60&step=20")
+	if w.Code != http.StatusOK {
+		t.Fatalf("code=%d body=%s", w.Code, w.Body)
+	}
+	var resp struct {
+		Visible  bool    `json:"visible"`
+		Distance float64 `json:"distance"`
+		FromAlt  float64 `json:"from_alt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Visible || resp.FromAlt != 60 || resp.Distance > 2000 {
+		t.Errorf("resp=%+v", resp)
+	}
+
+	for _, q := range []string{
+		"from_lat=30&from_lon=0&to_lat=31&to_lon=0&step=0.0001",
+		"from_lat=30&from_lon=0&to_lat=31&to_lon=0&step=NaN",
+		"from_lat=30&from_lon=0&to_lat=31&to_lon=0&step=2000",
+		"from_lat=95&from_lon=0&to_lat=31&to_lon=0",
+		"from_lat=30&from_lon=0&to_lat=30&to_lon=0.01&z=23",
+	} {
+		if w := get(q); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code=%d body=%s", q, w.Code, w.Body)
+		}
+	}
+
+	// длинная трасса с шагом по умолчанию упирается в лимит точек
+	w = httptest.NewRecorder()
+	srv.HandleLOS(w, httptest.NewRequest(http.MethodPost, "/los",
+		strings.NewReader(`{"from":{"lat":30,"lon":0},"to":{"lat":30,"lon":90}}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "increase step") {
+		t.Errorf("long path: code=%d body=%s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	srv.HandleLOS(w, httptest.NewRequest(http.MethodPost, "/los",
+		strings.NewReader(`{"from":{"lat":30,"lon":0},"to":{"lat":30,"lon":0.01}`+strings.Repeat(" ", maxJSONBody)+`}`)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("huge body: code=%d, want 413", w.Code)
+	}
+}
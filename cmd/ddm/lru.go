@@ -0,0 +1,100 @@
+package ddm
+
+import "container/list"
+
+// CacheStats — счётчики кэша тайлов в памяти.
+type CacheStats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	MaxTiles  int    `json:"max_tiles,omitempty"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// LRU на двусвязном списке: get/put за O(1). Ограничение — по числу тайлов
+// и/или по байтам (0 — без ограничения). Самый свежий тайл остаётся, даже
+// если один не влезает в бюджет. Не потокобезопасна — защищается владельцем.
+type lru struct {
+	maxTiles int
+	maxBytes int64
+	bytes    int64
+	ll       *list.List // спереди — самые свежие
+	m        map[string]*list.Element
+
+	hits, misses, evictions uint64
+}
+
+type lruEntry struct {
+	key  string
+	td   *tileData
+	size int64
+}
+
+func newLRU(maxTiles int, maxBytes int64) *lru {
+	if maxTiles <= 0 && maxBytes <= 0 {
+		maxTiles = 1
+	}
+	return &lru{maxTiles: maxTiles, maxBytes: maxBytes, ll: list.New(), m: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(k string) (*tileData, bool) {
+	if e, ok := l.m[k]; ok {
+		l.ll.MoveToFront(e)
+		l.hits++
+		return e.Value.(*lruEntry).td, true
+	}
+	l.misses++
+	return nil, false
+}
+
+// peek — без учёта в статистике и без продвижения.
+func (l *lru) peek(k string) (*tileData, bool) {
+	if e, ok := l.m[k]; ok {
+		return e.Value.(*lruEntry).td, true
+	}
+	return nil, false
+}
+
+func (l *lru) put(k string, v *tileData) {
+	size := v.sizeBytes()
+	if e, ok := l.m[k]; ok {
+		ent := e.Value.(*lruEntry)
+		l.bytes += size - ent.size
+		ent.td, ent.size = v, size
+		l.ll.MoveToFront(e)
+	} else {
+		l.m[k] = l.ll.PushFront(&lruEntry{key: k, td: v, size: size})
+		l.bytes += size
+	}
+	for l.ll.Len() > 1 && l.over() {
+		e := l.ll.Back()
+		ent := e.Value.(*lruEntry)
+		l.ll.Remove(e)
+		delete(l.m, ent.key)
+		l.bytes -= ent.size
+		l.evictions++
+	}
+}
+
+func (l *lru) over() bool {
+	return (l.maxTiles > 0 && l.ll.Len() > l.maxTiles) || (l.maxBytes > 0 && l.bytes > l.maxBytes)
+}
+
+func (l *lru) stats() CacheStats {
+	return CacheStats{
+		Entries:   l.ll.Len(),
+		Bytes:     l.bytes,
+		MaxBytes:  l.maxBytes,
+		MaxTiles:  l.maxTiles,
+		Hits:      l.hits,
+		Misses:    l.misses,
+		Evictions: l.evictions,
+	}
+}
+
+// sizeBytes — примерный вес тайла в памяти.
+func (t *tileData) sizeBytes() int64 {
+	return int64(len(t.Values))*4 + int64(len(t.Filled)) + int64(len(t.NoDataSet))*16 + 128
+}
@@ -0,0 +1,70 @@
+package ddm
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func gridTile(gs int) *tileData {
+	return &tileData{GridSize: gs, Values: make([]float32, gs*gs)}
+}
+
+func TestLRUByteBudget(t *testing.T) {
+	one := gridTile(10).sizeBytes()
+	l := newLRU(0, 3*one)
+	for _, k := range []string{"a", "b", "c"} {
+		l.put(k, gridTile(10))
+	}
+	l.get("a") // a — самый свежий, вытеснять будем b
+	l.put("d", gridTile(10))
+	if _, ok := l.peek("b"); ok {
+		t.Error("b should be evicted")
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, ok := l.peek(k); !ok {
+			t.Errorf("%s evicted", k)
+		}
+	}
+	l.get("zzz")
+
+	st := l.stats()
+	if st.Entries != 3 || st.Bytes != 3*one || st.Hits != 1 || st.Misses != 1 || st.Evictions != 1 {
+		t.Errorf("stats %+v", st)
+	}
+
+	// замена по тому же ключу учитывает новый размер
+	l.put("a", gridTile(20))
+	if st := l.stats(); st.Bytes != gridTile(20).sizeBytes() || st.Entries != 1 || st.Evictions != 3 {
+		t.Errorf("after big put: %+v", st)
+	}
+	// один тайл больше бюджета всё равно держим
+	if _, ok := l.peek("a"); !ok {
+		t.Error("oversized newest entry dropped")
+	}
+}
+
+func TestLRUTileLimit(t *testing.T) {
+	l := newLRU(2, 0)
+	l.put("a", gridTile(4))
+	l.put("b", gridTile(4))
+	l.put("c", gridTile(4))
+	if _, ok := l.get("a"); ok || l.ll.Len() != 2 {
+		t.Errorf("len=%d", l.ll.Len())
+	}
+}
+
+func TestHandleStats(t *testing.T) {
+	s := newTestStore(t)
+	_, _, _ = s.Height(t.Context(), 24.05, 55.78, 10) // тайла нет — промах
+
+	w := httptest.NewRecorder()
+	(&Server{Store: s}).HandleStats(w, httptest.NewRequest("GET", "/stats", nil))
+	var out map[string]CacheStats
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if st, ok := out["ddm"]; !ok || st.Misses == 0 {
+		t.Errorf("stats %+v", out)
+	}
+}
@@ -3,52 +3,33 @@ package ddm
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
-
-	"github.com/pavletto/altituder/cmd/terrain"
 )
 
 type Server struct {
-	Store *Store
-}
+	Store  *Store  // DDM-тайлы
+	Source Backend // источник высот для эндпоинтов; nil — Store
 
-func (s *Server) HandleIntersection(w http.ResponseWriter) {
-	adapter := &DEMAdapter{
-		Store:   s.Store, // твой *ddm.Store
-		Zoom:    14,
-		Timeout: 5 * time.Second,
-	}
-	q := [4]float64{28105, 2541, -4451, 16046}
-	for i := range q {
-		q[i] /= 32767.0
-	}
+	seedMu  sync.Mutex
+	seeds   map[string]*seedJob // задания /seed, живут до перезапуска
+	seedSeq int
+}
 
-	params := terrain.RaycastParams{
-		CamLon:  55.729469896669606,
-		CamLat:  25.00104389507723,
-		CamAlt:  177.72191600000002,
-		Quat:    q,
-		Step:    1.0,
-		MaxDist: 5000.0,
-		DEM:     adapter,
+func (s *Server) backend() Backend {
+	if s.Source != nil {
+		return s.Source
 	}
+	return s.Store
+}
 
-	lon, lat, ground, hit := terrain.Raycast(params)
-
-	fmt.Printf("hit=%v\nlon=%.10f\nlat=%.10f\nground=%.3f\n", hit, lon, lat, ground)
-
-	resp := map[string]any{
-		"lat":    lat,
-		"lon":    lon,
-		"ground": ground,
-		"hit":    hit,
+func (s *Server) defaultZoom() int {
+	if s.Store != nil {
+		return s.Store.Config().DefaultZoom
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(resp)
+	return 0
 }
 
 func (s *Server) HandleHeight(w http.ResponseWriter, r *http.Request) {
@@ -65,7 +46,7 @@ func (s *Server) HandleHeight(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	z := s.Store.Config().DefaultZoom
+	z := s.defaultZoom()
 	if zq := q.Get("z"); zq != "" {
 		if zi, err := strconv.Atoi(zq); err == nil {
 			z = zi
@@ -74,8 +55,16 @@ func (s *Server) HandleHeight(w http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
+	if iq := q.Get("interp"); iq != "" {
+		m, err := ParseInterp(iq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx = WithInterp(ctx, m)
+	}
 
-	h, meta, err := s.Store.Height(ctx, lat, lon, z)
+	h, meta, err := s.backend().Height(ctx, lat, lon, z)
 	if err != nil {
 		http.Error(w, "height lookup failed: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -88,11 +77,45 @@ func (s *Server) HandleHeight(w http.ResponseWriter, r *http.Request) {
 		"tile":        map[string]any{"z": meta.Z, "x": meta.X, "y": meta.Y},
 		"tile_source": meta.Source, // mem-cache | disk-cache | download
 		"grid_size":   meta.GridSize,
+		"filled":      meta.Filled, // высота опирается на заполненные void-fill узлы
+	}
+	if meta.Name != "" {
+		resp["tile_name"] = meta.Name
+	}
+	if meta.Interp != "" {
+		resp["interp"] = meta.Interp // может отличаться от запрошенного рядом с nodata
+	}
+	if meta.RequestedZ != 0 {
+		resp["requested_z"] = meta.RequestedZ
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// HandleStats — счётчики кэшей тайлов в памяти (ddm-тайлы и остальные источники).
+func (s *Server) HandleStats(w http.ResponseWriter, _ *http.Request) {
+	out := make(map[string]CacheStats)
+	if s.Store != nil {
+		out["ddm"] = s.Store.Stats()
+	}
+	add := func(name string, b Backend) {
+		if st, ok := b.(interface{ Stats() CacheStats }); ok && b != Backend(s.Store) {
+			out[name] = st.Stats()
+		}
+	}
+	switch src := s.Source.(type) {
+	case nil:
+	case *Composite:
+		for _, l := range src.Layers {
+			add(l.Name, l.Backend)
+		}
+	default:
+		add("source", src)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
 func (s *Server) HandleHealth(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
@@ -8,6 +8,18 @@ const (
 	minLat = -85.05112878
 )
 
+// wrapLon приводит долготу к [-180, 180): 180° → -180°, иначе tileXYZ даёт x = 2^z за краем сетки.
+func wrapLon(lon float64) float64 {
+	if lon >= 180 || lon < -180 {
+		lon = math.Mod(lon+180, 360)
+		if lon < 0 {
+			lon += 360
+		}
+		return lon - 180
+	}
+	return lon
+}
+
 // WGS84 lat/lon -> Spherical Mercator tile indices
 func tileXYZ(lat, lon float64, z int) (x, y int) {
 	if lat > maxLat {
@@ -32,3 +44,11 @@ func tileFrac(lat, lon float64, z, x, y int) (fx, fy float64) {
 
 func rad(d float64) float64 { return d * math.Pi / 180.0 }
 func sec(r float64) float64 { return 1.0 / math.Cos(r) }
+
+// Обратное к tileFrac: точка (fx,fy) внутри тайла z/x/y -> WGS84
+func tileFracToLatLon(z, x, y int, fx, fy float64) (lat, lon float64) {
+	n := math.Exp2(float64(z))
+	lon = (float64(x)+fx)/n*360.0 - 180.0
+	lat = deg(math.Atan(math.Sinh(math.Pi * (1 - 2*(float64(y)+fy)/n))))
+	return
+}
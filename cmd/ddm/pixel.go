@@ -0,0 +1,133 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+type cameraRequest struct {
+	Fx float64 `json:"fx"`
+	Fy float64 `json:"fy"` // 0 — равен fx
+	Cx float64 `json:"cx"`
+	Cy float64 `json:"cy"`
+	K1 float64 `json:"k1"`
+	K2 float64 `json:"k2"`
+	K3 float64 `json:"k3"`
+	P1 float64 `json:"p1"`
+	P2 float64 `json:"p2"`
+}
+
+type pixelRequest struct {
+	intersectionRequest
+	Camera cameraRequest `json:"camera"`
+	U      float64       `json:"u"`
+	V      float64       `json:"v"`
+}
+
+func (c cameraRequest) intrinsics() terrain.Intrinsics {
+	fy := c.Fy
+	if fy == 0 {
+		fy = c.Fx
+	}
+	return terrain.Intrinsics{
+		Fx: c.Fx, Fy: fy, Cx: c.Cx, Cy: c.Cy,
+		K1: c.K1, K2: c.K2, K3: c.K3, P1: c.P1, P2: c.P2,
+	}
+}
+
+// HandlePixel — геопривязка пикселя кадра: поза как у /intersection,
+// плюс fx,fy,cx,cy[,k1,k2,k3,p1,p2] и u,v.
+func (s *Server) HandlePixel(w http.ResponseWriter, r *http.Request) {
+	req, err := parsePixelRequest(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	params, err := s.raycastParams(&req.intersectionRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cam := req.Camera.intrinsics()
+	if err := cam.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	res, err := terrain.PixelToGround(ctx, terrain.PixelRaycastParams{
+		RaycastParams: params,
+		Camera:        cam,
+		U:             req.U,
+		V:             req.V,
+	})
+	if err != nil && !errors.Is(err, terrain.ErrUnknownTerrain) {
+		http.Error(w, "raycast failed: "+err.Error(), terrainErrorStatus(err))
+		return
+	}
+
+	resp := rayResponse(res, err)
+	resp["u"], resp["v"] = req.U, req.V
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func parsePixelRequest(w http.ResponseWriter, r *http.Request) (*pixelRequest, error) {
+	req := &pixelRequest{intersectionRequest: *newIntersectionRequest()}
+	if r.Method == http.MethodPost {
+		if err := decodeJSONBody(w, r, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	q := r.URL.Query()
+	if err := req.parseQuery(q); err != nil {
+		return nil, err
+	}
+	if err := parseCameraQuery(q, &req.Camera); err != nil {
+		return nil, err
+	}
+	var err error
+	if req.U, err = queryFloat(q.Get("u")); err != nil {
+		return nil, fmt.Errorf("invalid u")
+	}
+	if req.V, err = queryFloat(q.Get("v")); err != nil {
+		return nil, fmt.Errorf("invalid v")
+	}
+	return req, nil
+}
+
+// parseCameraQuery — intrinsics из query; fx,cx,cy обязательны.
+func parseCameraQuery(q url.Values, cam *cameraRequest) error {
+	fields := []struct {
+		key      string
+		dst      *float64
+		required bool
+	}{
+		{"fx", &cam.Fx, true}, {"fy", &cam.Fy, false},
+		{"cx", &cam.Cx, true}, {"cy", &cam.Cy, true},
+		{"k1", &cam.K1, false}, {"k2", &cam.K2, false}, {"k3", &cam.K3, false},
+		{"p1", &cam.P1, false}, {"p2", &cam.P2, false},
+	}
+	for _, f := range fields {
+		v := q.Get(f.key)
+		if v == "" && !f.required {
+			continue
+		}
+		var err error
+		if *f.dst, err = queryFloat(v); err != nil {
+			return fmt.Errorf("invalid %s", f.key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package ddm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlePixelBodyLimit(t *testing.T) {
+	srv := &Server{Source: &stubBackend{h: 50}}
+	body := `{"lat":25.5,"lon":55,"alt":300,"q":[1,0,0,0]` + strings.Repeat(" ", maxJSONBody) + `}`
+	w := httptest.NewRecorder()
+	srv.HandlePixel(w, httptest.NewRequest(http.MethodPost, "/pixel", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("huge body: code=%d, want 413", w.Code)
+	}
+	w = httptest.NewRecorder()
+	srv.HandlePixel(w, httptest.NewRequest(http.MethodPost, "/pixel", strings.NewReader(`{"lat":`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("broken body: code=%d, want 400", w.Code)
+	}
+}
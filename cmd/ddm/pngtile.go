@@ -0,0 +1,152 @@
+package ddm
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// TileFormat — кодировка тайлов источника.
+type TileFormat string
+
+const (
+	FormatDDM        TileFormat = "ddm"         // сырые float32 LE, узлы по краям тайла
+	FormatTerrainRGB TileFormat = "terrain-rgb" // Mapbox: h = -10000 + (R*65536 + G*256 + B) * 0.1
+	FormatTerrarium  TileFormat = "terrarium"   // Mapzen: h = R*256 + G + B/256 - 32768
+)
+
+// pngNoData — маркер прозрачного пикселя (alpha=0) в PNG-тайлах.
+const pngNoData = -math.MaxFloat32
+
+// maxPNGTileSize — предел стороны PNG-тайла: крупнее — не тайл, а попытка
+// заставить декодировать гигабайты RGBA.
+const maxPNGTileSize = 4096
+
+func ParseTileFormat(s string) (TileFormat, error) {
+	switch f := TileFormat(strings.ToLower(strings.TrimSpace(s))); f {
+	case "", FormatDDM:
+		return FormatDDM, nil
+	case FormatTerrainRGB, "mapbox", "terrainrgb":
+		return FormatTerrainRGB, nil
+	case FormatTerrarium:
+		return FormatTerrarium, nil
+	default:
+		return "", fmt.Errorf("unknown tile format %q (ddm|terrain-rgb|terrarium)", s)
+	}
+}
+
+// ext — расширение файла в дисковом кэше.
+func (f TileFormat) ext() string {
+	if f == FormatTerrainRGB || f == FormatTerrarium {
+		return ".png"
+	}
+	return ".ddm"
+}
+
+func decodeTile(f TileFormat, raw []byte, z, x, y int, factor float32, noData []float32) (*tileData, error) {
+	switch f {
+	case FormatTerrainRGB, FormatTerrarium:
+		return parsePNGTile(f, raw, z, x, y, factor, noData)
+	default:
+		return parseDDM(raw, z, x, y, factor, noData)
+	}
+}
+
+// checkTile — дешёвая проверка ответа без декодирования высот: размер сетки
+// DDM или заголовок PNG с квадратной картинкой не больше maxPNGTileSize.
+func checkTile(f TileFormat, raw []byte) error {
+	switch f {
+	case FormatTerrainRGB, FormatTerrarium:
+		cfg, err := png.DecodeConfig(bytes.NewReader(raw))
+		if err != nil {
+			return fmt.Errorf("%s: %w", f, err)
+		}
+		if cfg.Width != cfg.Height || cfg.Width < 2 {
+			return fmt.Errorf("%s: tile must be square, got %dx%d", f, cfg.Width, cfg.Height)
+		}
+		if cfg.Width > maxPNGTileSize {
+			return fmt.Errorf("%s: tile %dx%d too large (max %d)", f, cfg.Width, cfg.Height, maxPNGTileSize)
+		}
+		return nil
+	default:
+		n := len(raw) / 4
+		if gs := int(math.Round(math.Sqrt(float64(n)))); len(raw) == 0 || len(raw)%4 != 0 || gs*gs != n {
+			return fmt.Errorf("ddm: bad payload size %d", len(raw))
+		}
+		return nil
+	}
+}
+
+// parsePNGTile декодирует высоты из RGB. Значения относятся к центрам пикселей,
+// поэтому тайл помечается PixelIsArea.
+func parsePNGTile(f TileFormat, raw []byte, z, x, y int, factor float32, noData []float32) (*tileData, error) {
+	if err := checkTile(f, raw); err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f, err)
+	}
+	b := img.Bounds()
+	gs := b.Dx()
+	if gs != b.Dy() || gs < 2 {
+		return nil, fmt.Errorf("%s: non-square tile %dx%d", f, b.Dx(), b.Dy())
+	}
+
+	decode := terrainRGB
+	if f == FormatTerrarium {
+		decode = terrarium
+	}
+	vals := make([]float32, gs*gs)
+	for i := 0; i < gs; i++ {
+		for j := 0; j < gs; j++ {
+			c := pixelNRGBA(img, b.Min.X+j, b.Min.Y+i)
+			if c.A == 0 {
+				vals[i*gs+j] = pngNoData
+				continue
+			}
+			vals[i*gs+j] = float32(decode(c)) * factor
+		}
+	}
+
+	ns := make(map[float32]struct{}, len(noData)+1)
+	ns[pngNoData] = struct{}{}
+	for _, v := range noData {
+		ns[v*factor] = struct{}{}
+	}
+	return &tileData{
+		Z:           z,
+		X:           x,
+		Y:           y,
+		GridSize:    gs,
+		Values:      vals,
+		NoDataSet:   ns,
+		Factor:      factor,
+		PixelIsArea: true,
+	}, nil
+}
+
+func terrainRGB(c color.NRGBA) float64 {
+	return -10000 + float64(int(c.R)<<16|int(c.G)<<8|int(c.B))*0.1
+}
+
+func terrarium(c color.NRGBA) float64 {
+	return float64(c.R)*256 + float64(c.G) + float64(c.B)/256 - 32768
+}
+
+// pixelNRGBA — без аллокаций для типичных RGB(A) PNG, иначе через цветовую модель.
+func pixelNRGBA(img image.Image, x, y int) color.NRGBA {
+	switch m := img.(type) {
+	case *image.NRGBA:
+		return m.NRGBAAt(x, y)
+	case *image.RGBA:
+		if c := m.RGBAAt(x, y); c.A == 0xff || c.A == 0 {
+			return color.NRGBA{R: c.R, G: c.G, B: c.B, A: c.A}
+		}
+	}
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
@@ -0,0 +1,121 @@
+package ddm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPNGDecoders(t *testing.T) {
+	if h := terrainRGB(color.NRGBA{R: 1, G: 134, B: 160, A: 255}); math.Abs(h) > 1e-9 {
+		t.Errorf("terrain-rgb sea level: %v", h)
+	}
+	if h := terrarium(color.NRGBA{R: 128, G: 0, B: 0, A: 255}); h != 0 {
+		t.Errorf("terrarium sea level: %v", h)
+	}
+	if h := terrarium(color.NRGBA{R: 129, G: 44, B: 128, A: 255}); h != 300.5 {
+		t.Errorf("terrarium: %v", h)
+	}
+	if _, err := ParseTileFormat("webp"); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
+
+func TestStorePNGTiles(t *testing.T) {
+	const z, gs = 10, 8
+	val := func(i, j int) float64 { return 100 + 10*float64(i) + float64(j) }
+
+	for _, f := range []TileFormat{FormatTerrainRGB, FormatTerrarium} {
+		t.Run(string(f), func(t *testing.T) {
+			s, err := NewStore(StoreConfig{CacheDir: t.TempDir(), DefaultZoom: z, HeightFactor: 1, Format: f})
+			if err != nil {
+				t.Fatal(err)
+			}
+			lat0, lon0 := 24.05, 55.78
+			x, y := tileXYZ(lat0, lon0, z)
+
+			img := image.NewNRGBA(image.Rect(0, 0, gs, gs))
+			for i := 0; i < gs; i++ {
+				for j := 0; j < gs; j++ {
+					h := val(i, j)
+					var c color.NRGBA
+					if f == FormatTerrainRGB {
+						v := int(math.Round((h + 10000) * 10))
+						c = color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+					} else {
+						v := h + 32768
+						c = color.NRGBA{R: uint8(int(v) >> 8), G: uint8(int(v)), B: uint8((v - math.Floor(v)) * 256), A: 255}
+					}
+					if i == 5 && j == 5 {
+						c.A = 0 // дырка
+					}
+					img.SetNRGBA(j, i, c)
+				}
+			}
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				t.Fatal(err)
+			}
+			path := s.cachePath(z, x, y)
+			if filepath.Ext(path) != ".png" {
+				t.Fatalf("cache path %s", path)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			check := func(fx, fy, want float64) {
+				t.Helper()
+				lat, lon := tileFracToLatLon(z, x, y, fx, fy)
+				h, meta, err := s.Height(ctx, lat, lon, z)
+				if err != nil || math.Abs(h-want) > 1e-3 {
+					t.Errorf("frac (%v,%v): h=%v want %v err=%v", fx, fy, h, want, err)
+				}
+				if meta.GridSize != gs {
+					t.Errorf("grid %d", meta.GridSize)
+				}
+			}
+			// центр пикселя (2,3)
+			check((3+0.5)/gs, (2+0.5)/gs, val(2, 3))
+			// между центрами (2,3) и (2,4)
+			check(4.0/gs, (2+0.5)/gs, (val(2, 3)+val(2, 4))/2)
+			// у самого края — значение крайнего пикселя, без экстраполяции
+			check(0.01/gs, 0.01/gs, val(0, 0))
+			// прозрачный пиксель в интерполяцию не попадает: рядом с дыркой idw,
+			// точно в валидном узле — его значение
+			check((5+0.5)/gs, (4+0.5)/gs, val(4, 5))
+			check((5+0.5)/gs, (4+1.0)/gs, (val(4, 5)*4+val(4, 6)*4/5+val(5, 6)*4/5)/(4+4.0/5+4.0/5))
+		})
+	}
+}
+
+func TestPNGTileSizeLimit(t *testing.T) {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	raw := buf.Bytes()
+	if _, err := parsePNGTile(FormatTerrainRGB, raw, 0, 0, 0, 1, nil); err != nil {
+		t.Fatalf("small tile: %v", err)
+	}
+	// заголовок IHDR обещает 60000×60000, данных — на 4×4
+	binary.BigEndian.PutUint32(raw[16:], 60000)
+	binary.BigEndian.PutUint32(raw[20:], 60000)
+	binary.BigEndian.PutUint32(raw[29:], crc32.ChecksumIEEE(raw[12:29]))
+	if err := checkTile(FormatTerrainRGB, raw); err == nil {
+		t.Error("checkTile accepted a 60000px tile")
+	}
+	if _, err := parsePNGTile(FormatTerrarium, raw, 0, 0, 0, 1, nil); err == nil {
+		t.Error("parsePNGTile accepted a 60000px tile")
+	}
+}
@@ -0,0 +1,177 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxProfileSamples = 20000
+
+type ProfileSample struct {
+	Dist   float64 // расстояние вдоль трассы от первой точки, м
+	Lat    float64
+	Lon    float64
+	Height float64
+	Err    error
+}
+
+type Profile struct {
+	Samples  []ProfileSample
+	Length   float64
+	Min, Max float64
+	Ascent   float64
+	Descent  float64
+	Valid    int // сколько отсчётов с высотой
+}
+
+// Profile строит профиль рельефа вдоль ломаной по DDM-тайлам.
+func (s *Store) Profile(ctx context.Context, path []LatLon, step float64, z int) (*Profile, error) {
+	return ProfileAlong(ctx, s, path, step, z)
+}
+
+// ProfileAlong — профиль по произвольному источнику: каждый сегмент идёт по большому кругу
+// и дискретизируется с шагом step метров, вершины ломаной всегда попадают в отсчёты.
+func ProfileAlong(ctx context.Context, b Backend, path []LatLon, step float64, z int) (*Profile, error) {
+	if len(path) < 2 {
+		return nil, fmt.Errorf("profile: need at least 2 points")
+	}
+	if !(step > 0) || math.IsInf(step, 0) {
+		return nil, fmt.Errorf("profile: step must be a finite number > 0")
+	}
+
+	var pts []LatLon
+	var dists []float64
+	total := 0.0
+	for i := 0; i < len(path)-1; i++ {
+		a, b := path[i], path[i+1]
+		d := haversine(a, b)
+		for off := 0.0; off < d; off += step {
+			pt := a // вершина — ровно как задана, без погрешности тригонометрии
+			if off > 0 {
+				pt = intermediate(a, b, off/d)
+			}
+			pts = append(pts, pt)
+			dists = append(dists, total+off)
+			if len(pts) > maxProfileSamples {
+				return nil, fmt.Errorf("profile: too many samples (> %d), increase step", maxProfileSamples)
+			}
+		}
+		total += d
+	}
+	pts = append(pts, path[len(path)-1])
+	dists = append(dists, total)
+
+	res := b.HeightBatch(ctx, pts, z)
+
+	p := &Profile{
+		Samples: make([]ProfileSample, len(pts)),
+		Length:  total,
+		Min:     math.Inf(1),
+		Max:     math.Inf(-1),
+	}
+	prev := math.NaN()
+	for i, r := range res {
+		p.Samples[i] = ProfileSample{Dist: dists[i], Lat: pts[i].Lat, Lon: pts[i].Lon, Height: r.Height, Err: r.Err}
+		if r.Err != nil {
+			continue
+		}
+		p.Valid++
+		p.Min = math.Min(p.Min, r.Height)
+		p.Max = math.Max(p.Max, r.Height)
+		if !math.IsNaN(prev) {
+			if dh := r.Height - prev; dh > 0 {
+				p.Ascent += dh
+			} else {
+				p.Descent -= dh
+			}
+		}
+		prev = r.Height
+	}
+	if p.Valid == 0 {
+		p.Min, p.Max = 0, 0
+	}
+	return p, nil
+}
+
+// HandleProfile: POST {"path":[{lat,lon},...],"step":30,"z":14}
+// либо GeoJSON LineString/Feature, шаг и зум тогда в query (?step=30&z=14).
+func (s *Server) HandleProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPointsBody))
+	if err != nil {
+		http.Error(w, "read body: "+err.Error(), bodyErrorStatus(err))
+		return
+	}
+	var body struct {
+		Type string   `json:"type"`
+		Path []LatLon `json:"path"`
+		Step float64  `json:"step"`
+		Z    int      `json:"z"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		http.Error(w, "invalid json body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Type != "" {
+		if body.Path, err = parseGeoJSONPoints(raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	q := r.URL.Query()
+	if v := q.Get("step"); v != "" {
+		if body.Step, err = queryFloat(v); err != nil {
+			http.Error(w, "invalid step", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("z"); v != "" {
+		if body.Z, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid z", http.StatusBadRequest)
+			return
+		}
+	}
+	if body.Step == 0 {
+		body.Step = 30
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	p, err := ProfileAlong(ctx, s.backend(), body.Path, body.Step, body.Z)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	samples := make([]map[string]any, len(p.Samples))
+	for i, sm := range p.Samples {
+		item := map[string]any{"dist": sm.Dist, "lat": sm.Lat, "lon": sm.Lon, "height": sm.Height}
+		if sm.Err != nil {
+			item["height"] = nil
+			item["error"] = sm.Err.Error()
+		}
+		samples[i] = item
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"length":  p.Length,
+		"step":    body.Step,
+		"min":     p.Min,
+		"max":     p.Max,
+		"ascent":  p.Ascent,
+		"descent": p.Descent,
+		"valid":   p.Valid,
+		"samples": samples,
+	})
+}
@@ -0,0 +1,168 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfileAlong(t *testing.T) {
+	src := rampBackend{bbox: BBox{South: 20, West: 50, North: 30, East: 60}} // h = 1000*lon
+	a, b, c := LatLon{Lat: 25, Lon: 55.9}, LatLon{Lat: 25, Lon: 56.1}, LatLon{Lat: 25.1, Lon: 56.1}
+	const step = 1000.0
+
+	p, err := ProfileAlong(context.Background(), src, []LatLon{a, b, c}, step, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab, bc := haversine(a, b), haversine(b, c)
+	if math.Abs(p.Length-(ab+bc)) > 1e-6 {
+		t.Fatalf("length %v, want %v", p.Length, ab+bc)
+	}
+	first, last := p.Samples[0], p.Samples[len(p.Samples)-1]
+	if first.Lat != a.Lat || first.Lon != a.Lon || first.Dist != 0 || last.Lat != c.Lat || last.Lon != c.Lon || last.Dist != p.Length {
+		t.Fatalf("ends: %+v %+v", first, last)
+	}
+
+	vertex := false
+	for i, sm := range p.Samples {
+		if sm.Lat == b.Lat && sm.Lon == b.Lon && math.Abs(sm.Dist-ab) < 1e-6 {
+			vertex = true
+		}
+		if i > 0 {
+			if d := sm.Dist - p.Samples[i-1].Dist; d <= 0 || d > step+1e-6 {
+				t.Fatalf("spacing %v at %d", d, i)
+			}
+		}
+		// по большому кругу вдоль параллели дуга выгибается к полюсу
+		if sm.Dist > 0 && sm.Dist < ab && sm.Lat <= 25 {
+			t.Fatalf("sample %d not on the great circle: %+v", i, sm)
+		}
+	}
+	if !vertex {
+		t.Fatal("middle vertex not sampled")
+	}
+
+	if p.Valid != len(p.Samples) || p.Min != 55900 || math.Abs(p.Max-56100) > 1e-6 {
+		t.Fatalf("valid=%d min=%v max=%v", p.Valid, p.Min, p.Max)
+	}
+	if math.Abs(p.Ascent-200) > 1e-6 || p.Descent > 1e-6 {
+		t.Fatalf("ascent=%v descent=%v", p.Ascent, p.Descent)
+	}
+
+	// обратно: подъём становится спуском
+	r, _ := ProfileAlong(context.Background(), src, []LatLon{c, b, a}, step, 10)
+	if math.Abs(r.Descent-200) > 1e-6 || r.Ascent > 1e-6 {
+		t.Fatalf("reverse: ascent=%v descent=%v", r.Ascent, r.Descent)
+	}
+}
+
+func TestProfileNoDataAndLimits(t *testing.T) {
+	// западная часть трассы вне охвата — дыра
+	src := rampBackend{bbox: BBox{South: 20, West: 56, North: 30, East: 60}}
+	path := []LatLon{{Lat: 25, Lon: 55.9}, {Lat: 25, Lon: 56.1}}
+	p, err := ProfileAlong(context.Background(), src, path, 500, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps := 0
+	for _, sm := range p.Samples {
+		if sm.Err != nil {
+			gaps++
+			if sm.Lon >= 56 {
+				t.Fatalf("gap inside coverage: %+v", sm)
+			}
+		}
+	}
+	if gaps == 0 || p.Valid != len(p.Samples)-gaps {
+		t.Fatalf("gaps=%d valid=%d of %d", gaps, p.Valid, len(p.Samples))
+	}
+	if p.Min < 56000 || math.Abs(p.Max-56100) > 1e-6 {
+		t.Fatalf("min/max over valid samples: %v %v", p.Min, p.Max)
+	}
+
+	// вся трасса без данных — min/max нули, а не ±Inf
+	empty, _ := ProfileAlong(context.Background(), rampBackend{}, path, 500, 10)
+	if empty.Valid != 0 || empty.Min != 0 || empty.Max != 0 {
+		t.Fatalf("all nodata: %+v", empty)
+	}
+
+	long := []LatLon{{Lat: 25, Lon: 55}, {Lat: 25, Lon: 56}}
+	if _, err := ProfileAlong(context.Background(), src, long, 1, 10); err == nil || !strings.Contains(err.Error(), "too many samples") {
+		t.Fatalf("limit: %v", err)
+	}
+	for _, step := range []float64{0, -5, math.NaN(), math.Inf(1)} {
+		if _, err := ProfileAlong(context.Background(), src, path, step, 10); err == nil {
+			t.Errorf("step %v accepted", step)
+		}
+	}
+	if _, err := ProfileAlong(context.Background(), src, path[:1], 30, 10); err == nil {
+		t.Error("single point accepted")
+	}
+}
+
+func TestHandleProfile(t *testing.T) {
+	srv := &Server{Source: rampBackend{bbox: BBox{South: 20, West: 50, North: 30, East: 60}}}
+	do := func(method, target, body string) (*httptest.ResponseRecorder, map[string]any) {
+		w := httptest.NewRecorder()
+		srv.HandleProfile(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var resp map[string]any
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, resp
+	}
+
+	w, resp := do("POST", "/profile", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}],"step":1000}`)
+	if w.Code != 200 || resp["step"] != 1000.0 || resp["ascent"].(float64) < 199 {
+		t.Fatalf("json body: %d %v", w.Code, resp)
+	}
+	n := len(resp["samples"].([]any))
+
+	// GeoJSON, шаг из query
+	w, resp = do("POST", "/profile?step=500&z=12", `{"type":"Feature","geometry":{"type":"LineString","coordinates":[[55.9,25],[56.1,25]]}}`)
+	if w.Code != 200 || resp["step"] != 500.0 || len(resp["samples"].([]any)) <= n {
+		t.Fatalf("geojson: %d %v", w.Code, resp["step"])
+	}
+
+	// шаг по умолчанию 30 м
+	if w, resp = do("POST", "/profile", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":55.91}]}`); w.Code != 200 || resp["step"] != 30.0 {
+		t.Fatalf("default step: %d %v", w.Code, resp["step"])
+	}
+
+	// дыра отдаётся null с ошибкой
+	srv.Source = rampBackend{bbox: BBox{South: 20, West: 56, North: 30, East: 60}}
+	_, resp = do("POST", "/profile", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}],"step":1000}`)
+	s0 := resp["samples"].([]any)[0].(map[string]any)
+	if s0["height"] != nil || s0["error"] == nil {
+		t.Fatalf("nodata sample: %v", s0)
+	}
+
+	for _, tc := range []struct{ method, target, body string }{
+		{"POST", "/profile?step=NaN", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}]}`},
+		{"POST", "/profile?step=Inf", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}]}`},
+		{"POST", "/profile?step=-1", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}]}`},
+		{"POST", "/profile?step=abc", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}]}`},
+		{"POST", "/profile?z=x", `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}]}`},
+		{"POST", "/profile", `{"path":`},
+		{"POST", "/profile", `{"path":[{"lat":25,"lon":55.9}]}`},
+		{"POST", "/profile", `{"type":"Polygon","coordinates":[]}`},
+	} {
+		if w, _ := do(tc.method, tc.target, tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: %d", tc.target, tc.body, w.Code)
+		}
+	}
+	huge := `{"path":[{"lat":25,"lon":55.9},{"lat":25,"lon":56.1}]` + strings.Repeat(" ", maxPointsBody) + `}`
+	if w, _ := do("POST", "/profile", huge); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("huge body: %d, want 413", w.Code)
+	}
+	if w, _ := do("GET", "/profile", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: %d", w.Code)
+	}
+}
@@ -0,0 +1,123 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+type reprojectRequest struct {
+	intersectionRequest
+	Camera cameraRequest `json:"camera"`
+	Width  int           `json:"width"`
+	Height int           `json:"height"`
+	Target LatLon        `json:"target"`
+}
+
+// HandleReproject — точка на земле → пиксель кадра. Поза и камера как у /pixel,
+// точка — target_lat/target_lon (высота берётся из Store), кадр — width/height.
+func (s *Server) HandleReproject(w http.ResponseWriter, r *http.Request) {
+	req, err := parseReprojectRequest(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	if req.Target.Lat < minLat || req.Target.Lat > maxLat || req.Target.Lon < -180 || req.Target.Lon > 180 {
+		http.Error(w, "target out of range", http.StatusBadRequest)
+		return
+	}
+	params, err := s.raycastParams(&req.intersectionRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cam := req.Camera.intrinsics()
+	if err := cam.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	res, err := terrain.GroundToPixel(ctx, terrain.GroundToPixelParams{
+		RaycastParams: params,
+		Camera:        cam,
+		Width:         req.Width,
+		Height:        req.Height,
+		MaxRange:      maxRayDist,
+		Lat:           req.Target.Lat,
+		Lon:           req.Target.Lon,
+	})
+	if errors.Is(err, terrain.ErrTooManySamples) {
+		http.Error(w, err.Error()+", increase step", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, terrain.ErrUnknownTerrain) {
+		http.Error(w, "no terrain data at target: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "reprojection failed: "+err.Error(), terrainErrorStatus(err))
+		return
+	}
+
+	resp := map[string]any{
+		"target":   map[string]any{"lat": req.Target.Lat, "lon": req.Target.Lon, "ground": res.Ground},
+		"range":    res.Range,
+		"in_front": res.InFront,
+		"in_frame": res.InFrame,
+		"occluded": res.Occluded,
+		"unknown":  res.Unknown, // перекрытие не проверено: нет данных рельефа по лучу
+		"visible":  res.Visible(),
+		"u":        nil,
+		"v":        nil,
+	}
+	if res.InFront {
+		resp["u"], resp["v"] = res.U, res.V
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func parseReprojectRequest(w http.ResponseWriter, r *http.Request) (*reprojectRequest, error) {
+	req := &reprojectRequest{intersectionRequest: *newIntersectionRequest()}
+	if r.Method == http.MethodPost {
+		if err := decodeJSONBody(w, r, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	q := r.URL.Query()
+	if err := req.parseQuery(q); err != nil {
+		return nil, err
+	}
+	if err := parseCameraQuery(q, &req.Camera); err != nil {
+		return nil, err
+	}
+	var err error
+	if req.Target.Lat, err = queryFloat(q.Get("target_lat")); err != nil {
+		return nil, fmt.Errorf("invalid target_lat")
+	}
+	if req.Target.Lon, err = queryFloat(q.Get("target_lon")); err != nil {
+		return nil, fmt.Errorf("invalid target_lon")
+	}
+	if v := q.Get("width"); v != "" {
+		if req.Width, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid width")
+		}
+	}
+	if v := q.Get("height"); v != "" {
+		if req.Height, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid height")
+		}
+	}
+	return req, nil
+}
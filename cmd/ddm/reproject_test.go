@@ -0,0 +1,34 @@
+package ddm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleReprojectBodyLimit(t *testing.T) {
+	srv := &Server{Source: &stubBackend{h: 50}}
+	body := `{"lat":25.5,"lon":55,"alt":300,"q":[1,0,0,0]` + strings.Repeat(" ", maxJSONBody) + `}`
+	w := httptest.NewRecorder()
+	srv.HandleReproject(w, httptest.NewRequest(http.MethodPost, "/reproject", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("huge body: code=%d, want 413", w.Code)
+	}
+	w = httptest.NewRecorder()
+	srv.HandleReproject(w, httptest.NewRequest(http.MethodPost, "/reproject", strings.NewReader(`{"lat":`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("broken body: code=%d, want 400", w.Code)
+	}
+}
+
+func TestHandleReprojectTooManySteps(t *testing.T) {
+	srv := &Server{Source: &stubBackend{h: 50}}
+	// камера смотрит на восток, цель в ~40 км, шаг 1 мм
+	u := "/reproject?lat=25.5&lon=55&alt=300&q=0.7071068,0,0,0.7071068&step=0.001&max_dist=1&fx=1000&fy=1000&cx=500&cy=500&target_lat=25.5&target_lon=55.4"
+	w := httptest.NewRecorder()
+	srv.HandleReproject(w, httptest.NewRequest(http.MethodGet, u, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("code=%d, want 400: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,150 @@
+package ddm
+
+import (
+	"context"
+	"math"
+)
+
+// nodeFunc — значение узла (i — строка, j — столбец) и признак валидности (не nodata).
+type nodeFunc func(i, j int) (float32, bool)
+
+// cell — узел слева сверху от p и дробная часть.
+func cell(p float64) (int, float64) {
+	f := math.Floor(p)
+	return int(f), p - f
+}
+
+// inner сдвигает ячейку у последнего узла (n узлов) внутрь сетки: (n-2, f+1),
+// чтобы у краевой точки были реальные соседи, а не прижатые копии.
+func inner(i int, f float64, n int) (int, float64) {
+	if n >= 2 && i > n-2 {
+		return n - 2, f + float64(i-(n-2))
+	}
+	return i, f
+}
+
+// tileSampler читает узлы сетки зума z в сквозной нумерации, так что
+// интерполяция у края тайла берёт узлы соседнего тайла (подгружая его).
+// Если соседа нет — прижимаемся к краю своего тайла.
+type tileSampler struct {
+	ctx     context.Context
+	s       *Store
+	home    *tileData
+	z, x, y int
+	step    int // сдвиг между соседними тайлами в узлах: gs-1 (узлы на краях) или gs (центры пикселей)
+	nb      map[[2]int]*tileData
+}
+
+func (s *Store) newSampler(ctx context.Context, td *tileData, z, x, y int) *tileSampler {
+	step := td.GridSize - 1
+	if td.PixelIsArea {
+		step = td.GridSize
+	}
+	return &tileSampler{ctx: ctx, s: s, home: td, z: z, x: x, y: y, step: step}
+}
+
+// pos — сквозная дробная позиция точки в узлах сетки.
+func (ts *tileSampler) pos(lat, lon float64) (px, py float64) {
+	fx, fy := tileFrac(lat, lon, ts.z, ts.x, ts.y)
+	px = (float64(ts.x) + fx) * float64(ts.step)
+	py = (float64(ts.y) + fy) * float64(ts.step)
+	if ts.home.PixelIsArea {
+		px -= 0.5
+		py -= 0.5
+	}
+	return
+}
+
+func (ts *tileSampler) height(lat, lon float64, m Interp) (float64, Interp, bool) {
+	if ts.home.GridSize < 2 {
+		return 0, m, false
+	}
+	i, j, fx, fy := ts.cellAt(lat, lon)
+	return interpolate(m, i, j, fx, fy, ts.node)
+}
+
+// filledNear — хоть один угол ячейки точки заполнен void-fill'ом.
+func (ts *tileSampler) filledNear(lat, lon float64) bool {
+	i, j, _, _ := ts.cellAt(lat, lon)
+	for _, c := range [4][2]int{{0, 0}, {0, 1}, {1, 0}, {1, 1}} {
+		if td, li, lj := ts.locate(i+c[0], j+c[1]); td.isFilled(li, lj) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *tileSampler) cellAt(lat, lon float64) (i, j int, fx, fy float64) {
+	px, py := ts.pos(lat, lon)
+	i, fy = cell(py)
+	j, fx = cell(px)
+	if !ts.home.PixelIsArea {
+		// точка ровно на правой/нижней границе — берём последнюю ячейку своего тайла
+		if j == (ts.x+1)*ts.step && fx == 0 {
+			j, fx = j-1, 1
+		}
+		if i == (ts.y+1)*ts.step && fy == 0 {
+			i, fy = i-1, 1
+		}
+	}
+	return
+}
+
+func (ts *tileSampler) node(gi, gj int) (float32, bool) {
+	td, li, lj := ts.locate(gi, gj)
+	return td.node(li, lj)
+}
+
+// locate — тайл и локальные индексы узла со сквозными индексами (gi,gj).
+func (ts *tileSampler) locate(gi, gj int) (*tileData, int, int) {
+	tx, lj := floorDiv(gj, ts.step)
+	ty, li := floorDiv(gi, ts.step)
+	if !ts.home.PixelIsArea {
+		// узел на общей границе есть и в своём тайле — соседа не трогаем
+		if lj == 0 && tx == ts.x+1 {
+			tx, lj = ts.x, ts.step
+		}
+		if li == 0 && ty == ts.y+1 {
+			ty, li = ts.y, ts.step
+		}
+	}
+	td := ts.home
+	if tx != ts.x || ty != ts.y {
+		td = ts.neighbour(tx, ty)
+	}
+	if td == nil {
+		td = ts.home
+		li = min(max(gi-ts.y*ts.step, 0), td.GridSize-1)
+		lj = min(max(gj-ts.x*ts.step, 0), td.GridSize-1)
+	}
+	return td, li, lj
+}
+
+func (ts *tileSampler) neighbour(tx, ty int) *tileData {
+	n := 1 << ts.z
+	if ty < 0 || ty >= n {
+		return nil
+	}
+	tx = (tx%n + n) % n // через антимеридиан
+	if ts.nb == nil {
+		ts.nb = make(map[[2]int]*tileData)
+	}
+	k := [2]int{tx, ty}
+	if td, ok := ts.nb[k]; ok {
+		return td
+	}
+	td, _, err := ts.s.tile(ts.ctx, ts.z, tx, ty)
+	if err != nil || td.GridSize != ts.home.GridSize || td.PixelIsArea != ts.home.PixelIsArea {
+		td = nil
+	}
+	ts.nb[k] = td
+	return td
+}
+
+func floorDiv(a, b int) (q, r int) {
+	q = a / b
+	if a%b < 0 {
+		q--
+	}
+	return q, a - q*b
+}
@@ -0,0 +1,94 @@
+package ddm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// memTile кладёт тайл прямо в память; f получает сквозные индексы узла.
+func memTile(s *Store, z, x, y, gs int, area bool, f func(gi, gj int) float32) {
+	step := gs - 1
+	if area {
+		step = gs
+	}
+	vals := make([]float32, gs*gs)
+	for i := 0; i < gs; i++ {
+		for j := 0; j < gs; j++ {
+			vals[i*gs+j] = f(y*step+i, x*step+j)
+		}
+	}
+	s.putMem(fmt.Sprintf("%d/%d/%d", z, y, x), &tileData{
+		Z: z, X: x, Y: y, GridSize: gs, Values: vals,
+		NoDataSet: map[float32]struct{}{}, Factor: 1, PixelIsArea: area,
+	})
+}
+
+func TestSamplerAcrossTileEdges(t *testing.T) {
+	const z, gs = 10, 8
+	x, y := tileXYZ(24.05, 55.78, z)
+	ramp := func(gi, gj int) float32 { return float32(gj + 1000*gi) }
+	ctx := context.Background()
+
+	// точка на общем углу четырёх тайлов
+	lat, lon := tileFracToLatLon(z, x+1, y+1, 0, 0)
+
+	t.Run("pixel-is-area", func(t *testing.T) {
+		s := newTestStore(t)
+		for _, d := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			memTile(s, z, x+d[0], y+d[1], gs, true, ramp)
+		}
+		// домашний тайл — левый верхний, угол попадает между центрами пикселей соседей
+		h, _, ok := s.newSampler(ctx, mustMem(t, s, z, x, y), z, x, y).height(lat, lon, InterpBilinear)
+		gj, gi := float64((x+1)*gs)-0.5, float64((y+1)*gs)-0.5
+		if want := gj + 1000*gi; !ok || math.Abs(h-want) > 1e-3 {
+			t.Errorf("corner: h=%v want %v", h, want)
+		}
+
+		// тот же угол со стороны правого нижнего тайла — то же значение
+		h2, _, _ := s.newSampler(ctx, mustMem(t, s, z, x+1, y+1), z, x+1, y+1).height(lat, lon, InterpBilinear)
+		if math.Abs(h-h2) > 1e-3 {
+			t.Errorf("seam: %v vs %v", h, h2)
+		}
+
+		// через Store.Height — тоже без шва
+		hs, _, err := s.Height(ctx, lat, lon+1e-9, z)
+		if err != nil || math.Abs(hs-h) > 0.01 {
+			t.Errorf("Store.Height: %v err=%v", hs, err)
+		}
+	})
+
+	t.Run("missing neighbour clamps", func(t *testing.T) {
+		s := newTestStore(t)
+		memTile(s, z, x, y, gs, true, ramp)
+		h, _, ok := s.newSampler(ctx, mustMem(t, s, z, x, y), z, x, y).height(lat, lon, InterpBilinear)
+		last := float64(ramp(y*gs+gs-1, x*gs+gs-1))
+		if !ok || math.Abs(h-last) > 1e-3 {
+			t.Errorf("h=%v want %v", h, last)
+		}
+	})
+
+	t.Run("edge nodes need no neighbour", func(t *testing.T) {
+		s := newTestStore(t)
+		memTile(s, z, x, y, gs, false, ramp)
+		ts := s.newSampler(ctx, mustMem(t, s, z, x, y), z, x, y)
+		h, _, ok := ts.height(lat, lon, InterpBilinear)
+		want := float64(ramp((y+1)*(gs-1), (x+1)*(gs-1)))
+		if !ok || math.Abs(h-want) > 1e-3 {
+			t.Errorf("h=%v want %v", h, want)
+		}
+		if len(ts.nb) != 0 {
+			t.Errorf("neighbours touched: %v", ts.nb)
+		}
+	})
+}
+
+func mustMem(t *testing.T, s *Store, z, x, y int) *tileData {
+	t.Helper()
+	td, ok := s.getMem(fmt.Sprintf("%d/%d/%d", z, y, x))
+	if !ok {
+		t.Fatalf("no tile %d/%d/%d", z, x, y)
+	}
+	return td
+}
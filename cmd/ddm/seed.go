@@ -0,0 +1,590 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Area — район для предзагрузки тайлов: bbox, полигоны, коридор вдоль маршрута.
+type Area interface {
+	Bounds() BBox
+	intersects(b BBox) bool // пересекает ли охват тайла
+}
+
+func (b BBox) Bounds() BBox { return b }
+
+func (b BBox) intersects(o BBox) bool {
+	return b.West <= o.East && o.West <= b.East && b.South <= o.North && o.South <= b.North
+}
+
+// Polygons — внешние контуры полигонов (lat,lon); дырки не учитываются,
+// лишние тайлы для офлайна не страшны.
+type Polygons [][]LatLon
+
+func (p Polygons) validate() error {
+	if len(p) == 0 {
+		return fmt.Errorf("polygon: no rings")
+	}
+	for _, r := range p {
+		if len(r) < 3 {
+			return fmt.Errorf("polygon: ring needs at least 3 points")
+		}
+	}
+	return nil
+}
+
+func (p Polygons) Bounds() BBox {
+	b := boundsOf(p[0])
+	for _, r := range p[1:] {
+		b = b.union(boundsOf(r))
+	}
+	return b
+}
+
+func (p Polygons) intersects(b BBox) bool {
+	center := LatLon{Lat: (b.South + b.North) / 2, Lon: (b.West + b.East) / 2}
+	for _, r := range p {
+		// тайл целиком внутри контура — ни одно ребро его не пересекает
+		if inRing(r, center) {
+			return true
+		}
+		for i := range r {
+			if segmentHitsBox(r[i], r[(i+1)%len(r)], b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Corridor — полоса шириной 2*BufferM метров вдоль маршрута (или круг вокруг точки).
+type Corridor struct {
+	Path    []LatLon
+	BufferM float64
+}
+
+func (c Corridor) Bounds() BBox { return c.grow(boundsOf(c.Path)) }
+
+func (c Corridor) intersects(b BBox) bool {
+	// вместо расстояния до сегмента — попадание сегмента в тайл, раздутый на буфер:
+	// в углах захватывает чуть больше, зато просто и с запасом
+	b = c.grow(b)
+	if len(c.Path) == 1 {
+		return b.Contains(c.Path[0].Lat, c.Path[0].Lon)
+	}
+	for i := 0; i+1 < len(c.Path); i++ {
+		if segmentHitsBox(c.Path[i], c.Path[i+1], b) {
+			return true
+		}
+	}
+	return false
+}
+
+const metersPerDegree = 111320.0
+
+func (c Corridor) grow(b BBox) BBox {
+	dLat := c.BufferM / metersPerDegree
+	cos := math.Max(math.Cos(rad(math.Min(math.Max(math.Abs(b.South), math.Abs(b.North))+dLat, 89))), 0.01)
+	dLon := dLat / cos
+	return BBox{
+		South: math.Max(b.South-dLat, -90), North: math.Min(b.North+dLat, 90),
+		West: math.Max(b.West-dLon, -180), East: math.Min(b.East+dLon, 180),
+	}
+}
+
+// AreaSet — объединение районов (FeatureCollection, MultiLineString).
+type AreaSet []Area
+
+func (s AreaSet) Bounds() BBox {
+	b := s[0].Bounds()
+	for _, a := range s[1:] {
+		b = b.union(a.Bounds())
+	}
+	return b
+}
+
+func (s AreaSet) intersects(b BBox) bool {
+	for _, a := range s {
+		if a.Bounds().intersects(b) && a.intersects(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b BBox) union(o BBox) BBox {
+	return BBox{South: math.Min(b.South, o.South), West: math.Min(b.West, o.West), North: math.Max(b.North, o.North), East: math.Max(b.East, o.East)}
+}
+
+func boundsOf(pts []LatLon) BBox {
+	b := BBox{South: 90, West: 180, North: -90, East: -180}
+	for _, p := range pts {
+		b.South, b.North = math.Min(b.South, p.Lat), math.Max(b.North, p.Lat)
+		b.West, b.East = math.Min(b.West, p.Lon), math.Max(b.East, p.Lon)
+	}
+	return b
+}
+
+// inRing — чётность пересечений луча (в плоскости lon/lat).
+func inRing(r []LatLon, p LatLon) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			in = !in
+		}
+	}
+	return in
+}
+
+// segmentHitsBox — отсечение Лианга–Барски; концы внутри тоже считаются.
+func segmentHitsBox(a, c LatLon, b BBox) bool {
+	t0, t1 := 0.0, 1.0
+	clip := func(p, q float64) bool { // p*t <= q
+		if p == 0 {
+			return q >= 0
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return false
+			}
+			t0 = math.Max(t0, r)
+		} else {
+			if r < t0 {
+				return false
+			}
+			t1 = math.Min(t1, r)
+		}
+		return true
+	}
+	dx, dy := c.Lon-a.Lon, c.Lat-a.Lat
+	return clip(-dx, a.Lon-b.West) && clip(dx, b.East-a.Lon) &&
+		clip(-dy, a.Lat-b.South) && clip(dy, b.North-a.Lat)
+}
+
+func tileBounds(z, x, y int) BBox {
+	n, w := tileFracToLatLon(z, x, y, 0, 0)
+	s, e := tileFracToLatLon(z, x, y, 1, 1)
+	return BBox{South: s, West: w, North: n, East: e}
+}
+
+type TileID struct {
+	Z int `json:"z"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// SeedTiles перечисляет тайлы minZ..maxZ, задевающие район. Спуск идёт от z0
+// и дети проверяются только у задетых родителей, так что длинный коридор
+// не перебирает весь свой bbox.
+func SeedTiles(area Area, minZ, maxZ int) ([]TileID, error) {
+	return seedTiles(area, minZ, maxZ, 0)
+}
+
+// seedTiles с limit > 0 бросает перебор, как только тайлов становится больше.
+func seedTiles(area Area, minZ, maxZ, limit int) ([]TileID, error) {
+	if minZ < 0 || maxZ > 22 || minZ > maxZ {
+		return nil, fmt.Errorf("bad zoom range %d..%d", minZ, maxZ)
+	}
+	bounds := area.Bounds()
+	var out []TileID
+	level := []TileID{{0, 0, 0}}
+	for z := 0; ; z++ {
+		if z >= minZ {
+			out = append(out, level...)
+		}
+		if z == maxZ {
+			return out, nil
+		}
+		var next []TileID
+		for _, t := range level {
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					c := TileID{z + 1, 2*t.X + dx, 2*t.Y + dy}
+					if b := tileBounds(c.Z, c.X, c.Y); bounds.intersects(b) && area.intersects(b) {
+						next = append(next, c)
+						if limit > 0 && len(out)+len(next) > limit {
+							return nil, fmt.Errorf("%w: more than %d tiles", errAreaTooLarge, limit)
+						}
+					}
+				}
+			}
+		}
+		level = next
+	}
+}
+
+var (
+	errAreaTooLarge   = errors.New("area too large")
+	errSeedNoDownload = errors.New("seed: download disabled (no URL template)")
+)
+
+type SeedConfig struct {
+	MinZoom, MaxZoom int
+	Workers          int     // параллельных загрузок, по умолчанию 4
+	Rate             float64 // загрузок в секунду на всех; 0 — без ограничения
+	Refresh          bool    // перекачивать уже лежащие на диске; иначе пропуск — так и работает докачка
+
+	// Progress вызывается после каждого тайла под блокировкой — должен быть быстрым.
+	Progress func(SeedStats)
+}
+
+type SeedStats struct {
+	Total      int `json:"total"`
+	Done       int `json:"done"`
+	Downloaded int `json:"downloaded"`
+	Existed    int `json:"existed"` // уже были на диске
+	Missing    int `json:"missing"` // 404 у апстрима
+	Failed     int `json:"failed"`
+}
+
+const (
+	seedAttempts = 3
+	minSeedRate  = 0.1 // загрузок в секунду: медленнее — уже не ограничение, а зависание
+)
+
+// Seed скачивает тайлы района в CacheDir перед уходом в офлайн. Прерванный
+// запуск продолжается повтором: всё, что уже на диске, пропускается.
+func (s *Store) Seed(ctx context.Context, area Area, cfg SeedConfig) (SeedStats, error) {
+	if !s.cfg.PermitDownload {
+		return SeedStats{}, errSeedNoDownload
+	}
+	tiles, err := SeedTiles(area, cfg.MinZoom, cfg.MaxZoom)
+	if err != nil {
+		return SeedStats{}, err
+	}
+	return s.seed(ctx, tiles, cfg)
+}
+
+func (s *Store) seed(ctx context.Context, tiles []TileID, cfg SeedConfig) (SeedStats, error) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	var tick <-chan time.Time
+	if cfg.Rate > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / max(cfg.Rate, minSeedRate)))
+		defer t.Stop()
+		tick = t.C
+	}
+
+	var mu sync.Mutex
+	st := SeedStats{Total: len(tiles)}
+	count := func(c *int) {
+		mu.Lock()
+		defer mu.Unlock()
+		*c++
+		st.Done++
+		if cfg.Progress != nil {
+			cfg.Progress(st)
+		}
+	}
+
+	fetch := func(t TileID) error {
+		var err error
+		for attempt := 1; attempt <= seedAttempts; attempt++ {
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			if err = s.seedTile(ctx, t.Z, t.X, t.Y); err == nil || errors.Is(err, ErrTileNotFound) || ctx.Err() != nil {
+				return err
+			}
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return err
+	}
+
+	jobs := make(chan TileID)
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				if !cfg.Refresh {
+					if _, err := os.Stat(s.cachePath(t.Z, t.X, t.Y)); err == nil {
+						count(&st.Existed)
+						continue
+					}
+				}
+				switch err := fetch(t); {
+				case err == nil:
+					count(&st.Downloaded)
+				case errors.Is(err, ErrTileNotFound):
+					count(&st.Missing)
+				case ctx.Err() != nil:
+				default:
+					count(&st.Failed)
+				}
+			}
+		}()
+	}
+feed:
+	for _, t := range tiles {
+		select {
+		case jobs <- t:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return st, err
+	}
+	if st.Failed > 0 {
+		return st, fmt.Errorf("seed: %d of %d tiles failed, rerun to retry", st.Failed, st.Total)
+	}
+	return st, nil
+}
+
+// seedTile кладёт тайл на диск как есть: без декодирования, void-fill и
+// памяти — миллион тайлов предзагрузки не должен вытеснять горячий LRU.
+func (s *Store) seedTile(ctx context.Context, z, x, y int) error {
+	key := fmt.Sprintf("%d/%d/%d", z, y, x)
+	if s.knownMissing(key) {
+		return fmt.Errorf("%w: upstream has no %s", ErrTileNotFound, key)
+	}
+	_, err := s.fetchTile(ctx, z, x, y, func(raw []byte) error { return checkTile(s.cfg.Format, raw) })
+	if errors.Is(err, ErrTileNotFound) {
+		s.markMissing(key)
+	}
+	return err
+}
+
+// ---------------- API: фоновые задания предзагрузки ----------------
+
+// Ограничения заданий через API (у CLI их нет).
+const (
+	maxSeedJobTiles   = 1 << 20
+	maxSeedWorkers    = 16
+	maxSeedJobsActive = 4
+	seedJobKeep       = time.Hour // сколько помним завершённое задание
+)
+
+type seedJob struct {
+	ID       string    `json:"id"`
+	State    string    `json:"state"` // running | done | failed | canceled
+	Zoom     [2]int    `json:"zoom"`
+	Workers  int       `json:"workers"`
+	Stats    SeedStats `json:"stats"`
+	Error    string    `json:"error,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitzero"`
+
+	cancel context.CancelFunc
+}
+
+type seedRequest struct {
+	BBox    []float64       `json:"bbox"`    // [юг, запад, север, восток]
+	GeoJSON json.RawMessage `json:"geojson"` // Polygon/MultiPolygon/LineString/Feature(Collection)
+	Path    []LatLon        `json:"path"`    // маршрут полёта, коридор buffer_m
+	BufferM float64         `json:"buffer_m"`
+	MinZ    int             `json:"min_z"`
+	MaxZ    int             `json:"max_z"`
+	Workers int             `json:"workers"`
+	Rate    float64         `json:"rate"`
+	Refresh bool            `json:"refresh"`
+}
+
+func (r *seedRequest) area() (Area, error) {
+	switch {
+	case len(r.BBox) > 0:
+		if len(r.BBox) != 4 {
+			return nil, fmt.Errorf("bbox needs [south, west, north, east]")
+		}
+		b := BBox{South: r.BBox[0], West: r.BBox[1], North: r.BBox[2], East: r.BBox[3]}
+		if !b.valid() {
+			return nil, fmt.Errorf("bbox out of range")
+		}
+		return b, nil
+	case len(r.GeoJSON) > 0:
+		return ParseGeoJSONArea(r.GeoJSON, r.BufferM)
+	case len(r.Path) > 0:
+		return Corridor{Path: r.Path, BufferM: r.BufferM}, nil
+	}
+	return nil, fmt.Errorf("need bbox, geojson or path")
+}
+
+// HandleSeed: POST {"bbox":[s,w,n,e]} | {"geojson":{...}} | {"path":[{lat,lon},...],"buffer_m":500}
+// плюс min_z/max_z (по умолчанию DDM_DEFAULT_Z), workers (до 16), rate, refresh — запускает
+// фоновое задание (202); GET — список заданий.
+func (s *Server) HandleSeed(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.seedMu.Lock()
+		s.pruneSeedJobs()
+		jobs := make([]seedJob, 0, len(s.seeds))
+		for _, j := range s.seeds {
+			jobs = append(jobs, *j)
+		}
+		s.seedMu.Unlock()
+		sort.Slice(jobs, func(a, b int) bool { return jobs[a].Started.Before(jobs[b].Started) })
+		writeJSON(w, http.StatusOK, jobs)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Store == nil {
+		http.Error(w, "seed needs the ddm tile store", http.StatusNotImplemented)
+		return
+	}
+	if !s.Store.cfg.PermitDownload {
+		http.Error(w, errSeedNoDownload.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	var req seedRequest
+	if err := decodeJSONBodyLimit(w, r, &req, maxPointsBody); err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	area, err := req.area()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Rate < 0 || req.Workers < 0 {
+		http.Error(w, "rate and workers must be >= 0", http.StatusBadRequest)
+		return
+	}
+	if req.Workers == 0 {
+		req.Workers = 4
+	}
+	req.Workers = min(req.Workers, maxSeedWorkers)
+	if req.MaxZ == 0 {
+		req.MaxZ = s.defaultZoom()
+		if req.MinZ == 0 {
+			req.MinZ = req.MaxZ
+		}
+	}
+	tiles, err := seedTiles(area, req.MinZ, req.MaxZ, maxSeedJobTiles)
+	if errors.Is(err, errAreaTooLarge) {
+		err = fmt.Errorf("%w, use the seed command", err)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var job *seedJob // заполняется ниже, под seedMu
+	cfg := SeedConfig{
+		MinZoom: req.MinZ, MaxZoom: req.MaxZ,
+		Workers: req.Workers, Rate: req.Rate, Refresh: req.Refresh,
+		Progress: func(st SeedStats) {
+			s.seedMu.Lock()
+			job.Stats = st
+			s.seedMu.Unlock()
+		},
+	}
+	s.seedMu.Lock()
+	if s.seeds == nil {
+		s.seeds = make(map[string]*seedJob)
+	}
+	if s.pruneSeedJobs() >= maxSeedJobsActive {
+		s.seedMu.Unlock()
+		http.Error(w, fmt.Sprintf("%d seed jobs already running", maxSeedJobsActive), http.StatusTooManyRequests)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.seedSeq++
+	job = &seedJob{
+		ID:      strconv.Itoa(s.seedSeq),
+		State:   "running",
+		Zoom:    [2]int{req.MinZ, req.MaxZ},
+		Workers: cfg.Workers,
+		Stats:   SeedStats{Total: len(tiles)},
+		Started: time.Now().UTC(),
+		cancel:  cancel,
+	}
+	s.seeds[job.ID] = job
+	snapshot := *job
+	s.seedMu.Unlock()
+
+	go func() {
+		defer cancel()
+		st, err := s.Store.seed(ctx, tiles, cfg)
+		s.seedMu.Lock()
+		defer s.seedMu.Unlock()
+		job.Stats = st
+		job.Finished = time.Now().UTC()
+		switch {
+		case errors.Is(err, context.Canceled):
+			job.State = "canceled"
+		case err != nil:
+			job.State, job.Error = "failed", err.Error()
+		default:
+			job.State = "done"
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// pruneSeedJobs забывает давно завершённые задания и возвращает число идущих.
+// Вызывается под seedMu.
+func (s *Server) pruneSeedJobs() int {
+	active := 0
+	for id, j := range s.seeds {
+		switch {
+		case j.State == "running":
+			active++
+		case time.Since(j.Finished) > seedJobKeep:
+			delete(s.seeds, id)
+		}
+	}
+	return active
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// HandleSeedJob: GET /seed/{id} — прогресс задания, DELETE — отмена.
+func (s *Server) HandleSeedJob(w http.ResponseWriter, r *http.Request) {
+	s.seedMu.Lock()
+	job, ok := s.seeds[r.PathValue("id")]
+	var snapshot seedJob
+	if ok {
+		if r.Method == http.MethodDelete {
+			job.cancel()
+		}
+		snapshot = *job
+	}
+	s.seedMu.Unlock()
+	if !ok {
+		http.Error(w, "no such seed job", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		writeJSON(w, http.StatusOK, snapshot)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,301 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSeedTilesAreas(t *testing.T) {
+	box := BBox{South: 24, West: 55, North: 25, East: 56}
+	bt, err := SeedTiles(box, 8, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for z := 8; z <= 10; z++ {
+		x0, y0, x1, y1 := tileRange(box, z)
+		want += (x1 - x0 + 1) * (y1 - y0 + 1)
+	}
+	if len(bt) != want {
+		t.Fatalf("bbox: %d tiles, want %d", len(bt), want)
+	}
+
+	// треугольник в том же bbox: меньше тайлов, северо-западный угол не задет
+	tri := Polygons{{{Lat: 24, Lon: 55}, {Lat: 24, Lon: 56}, {Lat: 25, Lon: 56}}}
+	pt, _ := SeedTiles(tri, 10, 10)
+	x0, y0, x1, y1 := tileRange(box, 10)
+	if n := (x1 - x0 + 1) * (y1 - y0 + 1); len(pt) >= n || len(pt) < n/2 {
+		t.Fatalf("triangle: %d of %d tiles", len(pt), n)
+	}
+	for _, tl := range pt {
+		if tl.X == x0 && tl.Y == y0 {
+			t.Fatal("triangle includes the NW corner tile")
+		}
+	}
+	// тайл под вершиной и тайл внутри треугольника взяты
+	vx, vy := tileXYZ(24.01, 55.99, 10)
+	ix, iy := tileXYZ(24.3, 55.8, 10)
+	if !hasTile(pt, 10, vx, vy) || !hasTile(pt, 10, ix, iy) {
+		t.Fatal("triangle misses covered tiles")
+	}
+
+	// коридор: буфер шире тайла захватывает соседей, без буфера — только тайлы трассы
+	path := []LatLon{{Lat: 24.5, Lon: 55.1}, {Lat: 24.5, Lon: 55.9}}
+	thin, _ := SeedTiles(Corridor{Path: path}, 12, 12)
+	wide, _ := SeedTiles(Corridor{Path: path, BufferM: 20000}, 12, 12)
+	if len(thin) == 0 || len(wide) < 3*len(thin) {
+		t.Fatalf("corridor: thin=%d wide=%d", len(thin), len(wide))
+	}
+	for _, tl := range thin {
+		if _, y := tileXYZ(24.5, 55.5, 12); tl.Y != y {
+			t.Fatalf("thin corridor left its row: %+v", tl)
+		}
+	}
+}
+
+func TestSeedTilesLimit(t *testing.T) {
+	box := BBox{South: 24, West: 55, North: 25, East: 56}
+	all, err := SeedTiles(box, 10, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seedTiles(box, 10, 12, len(all)); err != nil {
+		t.Fatalf("exact limit: %v", err)
+	}
+	if _, err := seedTiles(box, 10, 12, len(all)-1); !errors.Is(err, errAreaTooLarge) {
+		t.Fatalf("over limit: err=%v", err)
+	}
+}
+
+func hasTile(ts []TileID, z, x, y int) bool {
+	for _, t := range ts {
+		if t == (TileID{z, x, y}) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSeedDownloadsAndResumes(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		x, _ := strconv.Atoi(strings.TrimSuffix(path.Base(r.URL.Path), ".ddm"))
+		if x%2 == 0 { // часть тайлов у апстрима отсутствует
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(flatDDM(9, 10))
+	}))
+	defer srv.Close()
+
+	s, err := NewStore(StoreConfig{
+		CacheDir:       t.TempDir(),
+		URLTemplate:    srv.URL + "/{z}/{y}/{x}.ddm",
+		PermitDownload: true,
+		DefaultZoom:    12,
+		HeightFactor:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	area := BBox{South: 24, West: 55, North: 24.2, East: 55.2}
+	cfg := SeedConfig{MinZoom: 11, MaxZoom: 12, Workers: 3}
+	var calls atomic.Int32
+	cfg.Progress = func(SeedStats) { calls.Add(1) }
+
+	st, err := s.Seed(context.Background(), area, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Done != st.Total || st.Downloaded+st.Missing != st.Total || st.Missing == 0 || st.Failed != 0 {
+		t.Fatalf("first run: %+v", st)
+	}
+	if int(calls.Load()) != st.Total || int(hits.Load()) != st.Total {
+		t.Fatalf("progress=%d hits=%d total=%d", calls.Load(), hits.Load(), st.Total)
+	}
+	// предзагрузка не декодирует тайлы в память
+	if ms := s.Stats(); ms.Entries != 0 {
+		t.Fatalf("seed filled the memory cache: %+v", ms)
+	}
+
+	// повтор: скачанное пропускается, за отсутствующими апстрим снова не дёргаем (негативный кэш)
+	hits.Store(0)
+	st2, err := s.Seed(context.Background(), area, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st2.Existed != st.Downloaded || st2.Missing != st.Missing || hits.Load() != 0 {
+		t.Fatalf("resume: %+v hits=%d", st2, hits.Load())
+	}
+}
+
+func TestHandleSeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(flatDDM(9, 10))
+	}))
+	defer srv.Close()
+	st, err := NewStore(StoreConfig{
+		CacheDir:       t.TempDir(),
+		URLTemplate:    srv.URL + "/{z}/{y}/{x}.ddm",
+		PermitDownload: true,
+		DefaultZoom:    12,
+		HeightFactor:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Store: st}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/seed", s.HandleSeed)
+	mux.HandleFunc("/seed/{id}", s.HandleSeedJob)
+
+	body := `{"path":[{"lat":24.05,"lon":55.78},{"lat":24.1,"lon":55.85}],"buffer_m":300,"rate":1000}`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/seed", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("post: %d %s", rec.Code, rec.Body)
+	}
+	var job seedJob
+	_ = json.Unmarshal(rec.Body.Bytes(), &job)
+	if job.ID == "" || job.Zoom != [2]int{12, 12} || job.Stats.Total == 0 {
+		t.Fatalf("job: %+v", job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.State == "running" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/seed/"+job.ID, nil))
+		_ = json.Unmarshal(rec.Body.Bytes(), &job)
+	}
+	if job.State != "done" || job.Stats.Downloaded != job.Stats.Total {
+		t.Fatalf("finished job: %+v", job)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/seed", strings.NewReader(`{"bbox":[0,0,80,170],"max_z":14}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("huge area accepted: %d", rec.Code)
+	}
+}
+
+func TestHandleSeedLimits(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	defer close(release)
+	st, err := NewStore(StoreConfig{
+		CacheDir:       t.TempDir(),
+		URLTemplate:    srv.URL + "/{z}/{y}/{x}.ddm",
+		PermitDownload: true,
+		DefaultZoom:    12,
+		HeightFactor:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Store: st}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/seed", s.HandleSeed)
+	mux.HandleFunc("/seed/{id}", s.HandleSeedJob)
+	post := func(body string) (*httptest.ResponseRecorder, seedJob) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/seed", strings.NewReader(body)))
+		var job seedJob
+		_ = json.Unmarshal(rec.Body.Bytes(), &job)
+		return rec, job
+	}
+
+	var ids []string
+	for i := 0; i < maxSeedJobsActive; i++ {
+		rec, job := post(`{"bbox":[24,55,24.1,55.1],"workers":1000}`)
+		if rec.Code != http.StatusAccepted || job.Workers != maxSeedWorkers {
+			t.Fatalf("job %d: %d workers=%d", i, rec.Code, job.Workers)
+		}
+		ids = append(ids, job.ID)
+	}
+	if rec, _ := post(`{"bbox":[24,55,24.1,55.1]}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("over active limit: %d", rec.Code)
+	}
+	if rec, _ := post(`{"bbox":[24,55,24.1,55.1],"rate":-1}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("negative rate: %d", rec.Code)
+	}
+	if rec, _ := post(`{"bbox":[24,55,24.1,55.1],"ratee":1}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown field: %d", rec.Code)
+	}
+	if rec, _ := post(`{"bbox":[24,55,24.1,55.1]` + strings.Repeat(" ", maxPointsBody) + `}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("huge body: %d", rec.Code)
+	}
+
+	for _, id := range ids {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/seed/"+id, nil))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runningSeedJobs(s) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("jobs not canceled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rec, _ := post(`{"bbox":[24,55,24.1,55.1],"rate":0.000001}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("after cancel: %d", rec.Code)
+	}
+
+	// завершённые задания забываются через seedJobKeep
+	s.seedMu.Lock()
+	for _, id := range ids {
+		s.seeds[id].Finished = time.Now().Add(-2 * seedJobKeep)
+	}
+	s.seedMu.Unlock()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/seed", nil))
+	var jobs []seedJob
+	_ = json.Unmarshal(rec.Body.Bytes(), &jobs)
+	if len(jobs) != 1 {
+		t.Fatalf("jobs after expiry: %d", len(jobs))
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/seed/"+jobs[0].ID, nil))
+}
+
+func TestHandleSeedNoDownload(t *testing.T) {
+	st, err := NewStore(StoreConfig{CacheDir: t.TempDir(), DefaultZoom: 12, HeightFactor: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Store: st}
+	rec := httptest.NewRecorder()
+	s.HandleSeed(rec, httptest.NewRequest(http.MethodPost, "/seed", strings.NewReader(`{"bbox":[24,55,24.1,55.1]}`)))
+	if rec.Code != http.StatusNotImplemented || runningSeedJobs(s) != 0 {
+		t.Fatalf("code=%d jobs=%d", rec.Code, runningSeedJobs(s))
+	}
+}
+
+func runningSeedJobs(s *Server) int {
+	s.seedMu.Lock()
+	defer s.seedMu.Unlock()
+	n := 0
+	for _, j := range s.seeds {
+		if j.State == "running" {
+			n++
+		}
+	}
+	return n
+}
@@ -2,6 +2,7 @@ package ddm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,53 +11,135 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type StoreConfig struct {
 	CacheDir          string
-	URLTemplate       string // "https://{s}.geodata.microavia.com/srtm/{z}/{y}/{x}.ddm"
+	URLTemplate       string     // "https://{s}.geodata.microavia.com/srtm/{z}/{y}/{x}.ddm"
+	Format            TileFormat // ddm | terrain-rgb | terrarium, по умолчанию ddm
 	Subdomains        []string
 	PermitDownload    bool
 	HTTPClientTimeout time.Duration
 
 	DefaultZoom   int
-	MaxNativeZoom int
+	MaxNativeZoom int // выше — берём родительский тайл этого зума (overzoom); 0 — без ограничения
+	MinZoom       int // нижняя граница отката к родителям, если тайла нет
+
+	Interp Interp // по умолчанию bilinear; переопределяется WithInterp
+
+	VoidFill       FillMethod // none | nearest | idw | laplace — при загрузке тайла
+	VoidFillRadius int        // в узлах сетки, 0 — DefaultFillRadius
 
 	HeightFactor float32
 	NoDataValues []float32
 
 	MaxMemTiles int
+	MaxMemBytes int64 // бюджет памяти под тайлы; вместе с MaxMemTiles — что наступит раньше
+
+	MaxDiskBytes int64         // лимит дискового кэша, вытесняются давно не читанные тайлы; 0 — без лимита
+	MaxDiskAge   time.Duration // тайлы без обращений дольше — удаляются; 0 — без ограничения
+	DiskTTL      time.Duration // после — фоновый условный запрос к апстриму (If-None-Match/If-Modified-Since); 0 — не перепроверять
+
+	// Bundle — tar-бандл (ExportBundle), читается после дискового кэша. С бандлом
+	// CacheDir можно не задавать: тогда только бандл, без диска и загрузки.
+	Bundle string
 }
 
 type Meta struct {
-	Z, X, Y  int
-	Source   string // mem-cache | disk-cache | download
-	GridSize int
+	Z, X, Y    int // тайл, из которого реально взята высота
+	RequestedZ int
+	Source     string // mem-cache | disk-cache | download
+	GridSize   int
+	Name       string // имя тайла у не-меркаторных источников (HGT: N24E055)
+	Interp     Interp // метод, которым реально посчитана высота
+	Filled     bool   // в интерполяцию попали узлы, заполненные void-fill
 }
 
+// Backend — источник высот, за которым стоят DDM-тайлы (Store), SRTM .hgt и т.п.
+// z имеет смысл только для меркаторных тайлов, остальные его игнорируют.
+type Backend interface {
+	Height(ctx context.Context, lat, lon float64, z int) (float64, Meta, error)
+	HeightBatch(ctx context.Context, pts []LatLon, z int) []PointResult
+}
+
+var (
+	ErrNoData       = errors.New("nodata around point")
+	ErrTileNotFound = errors.New("tile not found")
+)
+
 type Store struct {
 	cfg   StoreConfig
 	http  *http.Client
 	memMu sync.Mutex
 	mem   *lru // key "z/x/y"
-	subIx int
+	subIx atomic.Uint32
+
+	flMu     sync.Mutex
+	inflight map[string]*flight
+
+	disk   *diskJanitor // nil — без лимитов на диск
+	bundle *Bundle
+
+	missMu  sync.Mutex
+	missing map[string]time.Time // 404 от апстрима, чтобы не дёргать его при каждом откате
+	reval   map[string]time.Time // последняя фоновая перепроверка (под missMu)
+
+	metaMu sync.Mutex // чтение-запись сайдкаров .meta
 }
 
+// missingTTL — сколько помним, что апстрим не отдал тайл.
+const missingTTL = 10 * time.Minute
+
 func NewStore(cfg StoreConfig) (*Store, error) {
-	if cfg.CacheDir == "" {
+	var bundle *Bundle
+	if cfg.Bundle != "" {
+		b, err := OpenBundle(cfg.Bundle)
+		if err != nil {
+			return nil, err
+		}
+		bundle = b
+		if cfg.Format == "" {
+			cfg.Format = b.Index.Format
+		}
+	}
+	if cfg.CacheDir == "" && bundle == nil {
 		return nil, fmt.Errorf("CacheDir required")
 	}
-	if err := os.MkdirAll(cfg.CacheDir, 0o755); err != nil {
+	if cfg.CacheDir == "" {
+		cfg.PermitDownload = false // качать некуда
+	} else if err := os.MkdirAll(cfg.CacheDir, 0o755); err != nil {
 		return nil, err
 	}
-	if cfg.MaxMemTiles <= 0 {
+	if cfg.MaxMemTiles <= 0 && cfg.MaxMemBytes <= 0 {
 		cfg.MaxMemTiles = 64
 	}
+	format, err := ParseTileFormat(string(cfg.Format))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Format = format
+	if bundle != nil && bundle.Index.Format != format {
+		bundle.Close()
+		return nil, fmt.Errorf("bundle %s holds %s tiles, store format is %s", cfg.Bundle, bundle.Index.Format, format)
+	}
+	if cfg.Interp, err = ParseInterp(string(cfg.Interp)); err != nil {
+		return nil, err
+	}
+	if cfg.VoidFill, err = ParseFillMethod(string(cfg.VoidFill)); err != nil {
+		return nil, err
+	}
 	return &Store{
 		cfg:  cfg,
 		http: &http.Client{Timeout: cfg.HTTPClientTimeout},
-		mem:  newLRU(cfg.MaxMemTiles),
+		mem:  newLRU(cfg.MaxMemTiles, cfg.MaxMemBytes),
+
+		missing:  make(map[string]time.Time),
+		reval:    make(map[string]time.Time),
+		inflight: make(map[string]*flight),
+		disk:     newDiskJanitor(cfg.CacheDir, cfg.MaxDiskBytes, cfg.MaxDiskAge),
+		bundle:   bundle,
 	}, nil
 }
 
@@ -66,65 +149,231 @@ func (s *Store) Height(ctx context.Context, lat, lon float64, z int) (float64, M
 	if z <= 0 {
 		z = s.cfg.DefaultZoom
 	}
+	nz := s.nativeZoom(z)
+	lon = wrapLon(lon)
+	x, y := tileXYZ(lat, lon, nz)
 
-	x, y := tileXYZ(lat, lon, z)
-	key := fmt.Sprintf("%d/%d/%d", z, y, x)
+	td, meta, err := s.tileOrParent(ctx, nz, x, y)
+	meta.RequestedZ = z
+	if err != nil {
+		return 0, meta, err
+	}
+	ts := s.newSampler(ctx, td, meta.Z, meta.X, meta.Y)
+	h, used, ok := ts.height(lat, lon, interpFrom(ctx, s.cfg.Interp))
+	meta.Interp = used
+	meta.Filled = ok && ts.filledNear(lat, lon)
+	if !ok {
+		return 0, meta, ErrNoData
+	}
+	return h, meta, nil
+}
+
+// nativeZoom — зум, на котором тайлы реально существуют: выше MaxNativeZoom
+// интерполируем внутри родительского тайла.
+func (s *Store) nativeZoom(z int) int {
+	if s.cfg.MaxNativeZoom > 0 && z > s.cfg.MaxNativeZoom {
+		return s.cfg.MaxNativeZoom
+	}
+	return z
+}
+
+// tileOrParent достаёт тайл z/x/y, а если его нет ни в кэше, ни на апстриме —
+// ближайшего предка не ниже MinZoom. Meta описывает тайл, который нашёлся.
+func (s *Store) tileOrParent(ctx context.Context, z, x, y int) (*tileData, Meta, error) {
 	meta := Meta{Z: z, X: x, Y: y}
+	if z < s.cfg.MinZoom {
+		return nil, meta, fmt.Errorf("%w: z%d below min zoom %d", ErrTileNotFound, z, s.cfg.MinZoom)
+	}
+	var firstErr error
+	for zz := z; zz >= s.cfg.MinZoom && zz >= 0; zz-- {
+		td, src, err := s.tile(ctx, zz, x, y)
+		if err == nil {
+			return td, Meta{Z: zz, X: x, Y: y, Source: src, GridSize: td.GridSize}, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !errors.Is(err, ErrTileNotFound) {
+			return nil, Meta{Z: zz, X: x, Y: y}, err
+		}
+		x, y = x>>1, y>>1
+	}
+	return nil, meta, firstErr
+}
+
+// tile достаёт тайл по цепочке mem → disk → bundle → download и возвращает источник.
+func (s *Store) tile(ctx context.Context, z, x, y int) (*tileData, string, error) {
+	key := fmt.Sprintf("%d/%d/%d", z, y, x)
 
 	// 1) mem
 	if td, ok := s.getMem(key); ok {
-		meta.Source = "mem-cache"
-		h, ok := heightFromTile(td, lat, lon, z, x, y)
-		meta.GridSize = td.GridSize
-		if ok {
-			return h, meta, nil
+		return td, "mem-cache", nil
+	}
+
+	// 2) disk (без CacheDir — только бандл)
+	if s.cfg.CacheDir != "" {
+		if td, err := s.loadFromDisk(z, x, y); err == nil {
+			s.diskHit(z, x, y)
+			s.putMem(key, td)
+			return td, "disk-cache", nil
 		}
-		return 0, meta, fmt.Errorf("nodata around point")
 	}
 
-	// 2) disk
-	if td, err := s.loadFromDisk(z, x, y); err == nil {
-		s.putMem(key, td)
-		meta.Source = "disk-cache"
-		meta.GridSize = td.GridSize
-		h, ok := heightFromTile(td, lat, lon, z, x, y)
-		if ok {
-			return h, meta, nil
+	// 3) bundle
+	if s.bundle != nil {
+		raw, err := s.bundle.ReadTile(z, x, y)
+		if err == nil {
+			td, err := s.decode(raw, z, x, y)
+			if err != nil {
+				return nil, "", err
+			}
+			s.putMem(key, td)
+			return td, "bundle", nil
+		}
+		if !errors.Is(err, ErrTileNotFound) {
+			return nil, "", err
 		}
-		return 0, meta, fmt.Errorf("nodata around point")
 	}
 
-	// 3) download
+	// 4) download
 	if s.cfg.PermitDownload {
-		td, err := s.downloadTile(ctx, z, x, y)
+		td, src, err := s.download(ctx, z, x, y)
 		if err != nil {
-			return 0, meta, err
+			return nil, "", err
 		}
-		s.putMem(key, td)
-		meta.Source = "download"
-		meta.GridSize = td.GridSize
-		h, ok := heightFromTile(td, lat, lon, z, x, y)
-		if ok {
-			return h, meta, nil
+		return td, src, nil
+	}
+
+	return nil, "", fmt.Errorf("%w and download disabled", ErrTileNotFound)
+}
+
+// TileRaw отдаёт байты тайла как они лежат в кэше или бандле (при промахе
+// качает его с апстрима, если разрешено) вместе со временем изменения и источником.
+func (s *Store) TileRaw(ctx context.Context, z, x, y int) ([]byte, time.Time, string, error) {
+	path := s.cachePath(z, x, y)
+	readDisk := func(src string) ([]byte, time.Time, string, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, time.Time{}, "", err
+		}
+		raw, err := os.ReadFile(path)
+		return raw, fi.ModTime(), src, err
+	}
+	if s.cfg.CacheDir != "" {
+		if raw, mod, src, err := readDisk("disk-cache"); err == nil {
+			s.diskHit(z, x, y)
+			return raw, mod, src, nil
+		}
+	}
+	if s.bundle != nil {
+		raw, err := s.bundle.ReadTile(z, x, y)
+		if err == nil {
+			return raw, s.bundle.Index.Created, "bundle", nil
+		}
+		if !errors.Is(err, ErrTileNotFound) {
+			return nil, time.Time{}, "", err
+		}
+	}
+	if !s.cfg.PermitDownload {
+		return nil, time.Time{}, "", fmt.Errorf("%w and download disabled", ErrTileNotFound)
+	}
+	_, src, err := s.download(ctx, z, x, y)
+	if err != nil {
+		return nil, time.Time{}, "", err
+	}
+	return readDisk(src)
+}
+
+// downloadTimeout ограничивает общую загрузку: её ждут несколько запросов,
+// поэтому отмена одного из них загрузку не прерывает.
+const downloadTimeout = time.Minute
+
+type flight struct {
+	done chan struct{}
+	td   *tileData
+	src  string // download | revalidated (304, тайл с диска)
+	err  error
+}
+
+// download качает тайл один раз на ключ, сколько бы запросов его ни ждали
+// (singleflight); каждый ждущий уходит по своему ctx.
+func (s *Store) download(ctx context.Context, z, x, y int) (*tileData, string, error) {
+	return s.downloadOnce(ctx, z, x, y, true)
+}
+
+// downloadOnce с memOK=false не довольствуется тайлом в памяти — для перепроверки.
+func (s *Store) downloadOnce(ctx context.Context, z, x, y int, memOK bool) (*tileData, string, error) {
+	key := fmt.Sprintf("%d/%d/%d", z, y, x)
+	if s.knownMissing(key) {
+		return nil, "", fmt.Errorf("%w: upstream has no %s", ErrTileNotFound, key)
+	}
+
+	s.flMu.Lock()
+	f, ok := s.inflight[key]
+	if !ok {
+		// пока ждали блокировку, тайл мог уже прийти
+		if td, hit := s.peekMem(key); hit && memOK {
+			s.flMu.Unlock()
+			return td, "mem-cache", nil
 		}
-		return 0, meta, fmt.Errorf("nodata around point")
+		f = &flight{done: make(chan struct{})}
+		s.inflight[key] = f
+		go func() {
+			dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), downloadTimeout)
+			defer cancel()
+			var notModified bool
+			f.td, notModified, f.err = s.downloadTile(dctx, z, x, y)
+			f.src = "download"
+			if notModified {
+				f.src = "revalidated"
+			}
+			if f.err == nil {
+				s.putMem(key, f.td)
+			} else if errors.Is(f.err, ErrTileNotFound) {
+				s.markMissing(key)
+			}
+			s.flMu.Lock()
+			delete(s.inflight, key)
+			s.flMu.Unlock()
+			close(f.done)
+		}()
 	}
+	s.flMu.Unlock()
 
-	return 0, meta, fmt.Errorf("tile not found and download disabled")
+	select {
+	case <-f.done:
+		return f.td, f.src, f.err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
 }
 
-func heightFromTile(td *tileData, lat, lon float64, z, x, y int) (float64, bool) {
-	fx, fy := tileFrac(lat, lon, z, x, y) // 0..1
-	return td.heightAtFrac(fx, fy)
+func (s *Store) knownMissing(key string) bool {
+	s.missMu.Lock()
+	defer s.missMu.Unlock()
+	t, ok := s.missing[key]
+	if ok && time.Since(t) > missingTTL {
+		delete(s.missing, key)
+		return false
+	}
+	return ok
+}
+
+func (s *Store) markMissing(key string) {
+	s.missMu.Lock()
+	defer s.missMu.Unlock()
+	if len(s.missing) >= 10000 {
+		s.missing = make(map[string]time.Time)
+	}
+	s.missing[key] = time.Now()
 }
 
 func (s *Store) expandURL(z, x, y int) string {
 	u := s.cfg.URLTemplate
 	// подставим {s} циклически
 	sub := ""
-	if len(s.cfg.Subdomains) > 0 {
-		s.subIx = (s.subIx + 1) % len(s.cfg.Subdomains)
-		sub = s.cfg.Subdomains[s.subIx]
+	if n := len(s.cfg.Subdomains); n > 0 {
+		sub = s.cfg.Subdomains[int(s.subIx.Add(1)%uint32(n))]
 	}
 	repl := map[string]string{
 		"{s}": fmt.Sprintf("%s", sub),
@@ -139,7 +388,12 @@ func (s *Store) expandURL(z, x, y int) string {
 }
 
 func (s *Store) cachePath(z, x, y int) string {
-	return filepath.Join(s.cfg.CacheDir, fmt.Sprintf("%d/%d/%d.ddm", z, y, x))
+	return TilePath(s.cfg.CacheDir, s.cfg.Format, z, x, y)
+}
+
+// TilePath — раскладка тайлов на диске: {dir}/{z}/{y}/{x}.{ddm|png}
+func TilePath(dir string, f TileFormat, z, x, y int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d/%d/%d%s", z, y, x, f.ext()))
 }
 
 func (s *Store) loadFromDisk(z, x, y int) (*tileData, error) {
@@ -148,86 +402,120 @@ func (s *Store) loadFromDisk(z, x, y int) (*tileData, error) {
 	if err != nil {
 		return nil, err
 	}
-	return parseDDM(raw, z, x, y, s.cfg.HeightFactor, s.cfg.NoDataValues)
+	return s.decode(raw, z, x, y)
+}
+
+// decode разбирает тайл и при необходимости латает дыры (в памяти, на диске исходник).
+func (s *Store) decode(raw []byte, z, x, y int) (*tileData, error) {
+	td, err := decodeTile(s.cfg.Format, raw, z, x, y, s.cfg.HeightFactor, s.cfg.NoDataValues)
+	if err != nil {
+		return nil, err
+	}
+	td.fillVoids(s.cfg.VoidFill, s.cfg.VoidFillRadius)
+	return td, nil
+}
+
+// downloadTile качает и декодирует тайл; если на диске есть копия с
+// ETag/Last-Modified — запрос условный, и на 304 возвращается дисковая копия (notModified).
+func (s *Store) downloadTile(ctx context.Context, z, x, y int) (td *tileData, notModified bool, err error) {
+	// битый ответ в кэш не кладём
+	notModified, err = s.fetchTile(ctx, z, x, y, func(raw []byte) (err error) {
+		td, err = s.decode(raw, z, x, y)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if notModified {
+		if td, err = s.loadFromDisk(z, x, y); err != nil {
+			return nil, false, err
+		}
+	}
+	return td, notModified, nil
 }
 
-func (s *Store) downloadTile(ctx context.Context, z, x, y int) (*tileData, error) {
+// fetchTile делает (условный) запрос к апстриму и, если check пропустил ответ,
+// атомарно кладёт его в дисковый кэш. На 304 обновляется только сайдкар.
+func (s *Store) fetchTile(ctx context.Context, z, x, y int, check func(raw []byte) error) (notModified bool, err error) {
 	url := s.expandURL(z, x, y)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, err
+		return false, err
+	}
+	path := s.cachePath(z, x, y)
+	if s.cfg.DiskTTL > 0 {
+		if m, err := readTileMeta(path); err == nil {
+			if m.ETag != "" {
+				req.Header.Set("If-None-Match", m.ETag)
+			}
+			if m.LastModified != "" {
+				req.Header.Set("If-Modified-Since", m.LastModified)
+			}
+		}
 	}
 	resp, err := s.http.Do(req)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, url)
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		if _, err := os.Stat(path); err != nil {
+			return false, err
+		}
+		s.writeTileMeta(path, resp)
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		// тайла нет у сервера — пусть следующий слой попробует
+		return false, fmt.Errorf("%w: http 404: %s", ErrTileNotFound, url)
+	case resp.StatusCode != 200:
+		return false, fmt.Errorf("http %d: %s", resp.StatusCode, url)
 	}
 	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	// сохранить
-	path := s.cachePath(z, x, y)
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return nil, err
+	if err := check(raw); err != nil {
+		return false, fmt.Errorf("%s: %w", url, err)
 	}
-	if err := os.WriteFile(path, raw, 0o644); err != nil {
-		return nil, err
+	var replaced int64 // перекачка или перепроверка по TTL заменяет уже учтённый файл
+	if fi, err := os.Stat(path); err == nil {
+		replaced = fi.Size()
 	}
-	return parseDDM(raw, z, x, y, s.cfg.HeightFactor, s.cfg.NoDataValues)
-}
-
-// простая LRU
-
-type lru struct {
-	cap int
-	ll  []string
-	m   map[string]*tileData
+	if err := writeFileAtomic(path, raw); err != nil {
+		return false, err
+	}
+	s.writeTileMeta(path, resp)
+	s.disk.added(int64(len(raw)), replaced)
+	return false, nil
 }
 
-func newLRU(cap int) *lru {
-	if cap <= 0 {
-		cap = 1
+// writeFileAtomic пишет во временный файл рядом и переименовывает, так что
+// читатель видит либо старый файл, либо целиком новый.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
 	}
-	return &lru{cap: cap, ll: make([]string, 0, cap), m: make(map[string]*tileData)}
-}
-func (l *lru) get(k string) (*tileData, bool) {
-	if v, ok := l.m[k]; ok {
-		l.touch(k)
-		return v, true
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
 	}
-	return nil, false
-}
-func (l *lru) put(k string, v *tileData) {
-	if _, ok := l.m[k]; ok {
-		l.m[k] = v
-		l.touch(k)
-		return
-	}
-	if len(l.ll) == l.cap {
-		evict := l.ll[len(l.ll)-1]
-		delete(l.m, evict)
-		l.ll = l.ll[:len(l.ll)-1]
-	}
-	l.ll = append([]string{k}, l.ll...)
-	l.m[k] = v
-}
-func (l *lru) touch(k string) {
-	idx := -1
-	for i, s := range l.ll {
-		if s == k {
-			idx = i
-			break
-		}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	if idx <= 0 {
-		return
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
 	}
-	copy(l.ll[1:idx+1], l.ll[0:idx])
-	l.ll[0] = k
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
 }
 
 func (s *Store) getMem(key string) (*tileData, bool) {
@@ -235,12 +523,25 @@ func (s *Store) getMem(key string) (*tileData, bool) {
 	defer s.memMu.Unlock()
 	return s.mem.get(key)
 }
+func (s *Store) peekMem(key string) (*tileData, bool) {
+	s.memMu.Lock()
+	defer s.memMu.Unlock()
+	return s.mem.peek(key)
+}
+
 func (s *Store) putMem(key string, td *tileData) {
 	s.memMu.Lock()
 	defer s.memMu.Unlock()
 	s.mem.put(key, td)
 }
 
+// Stats — счётчики кэша тайлов в памяти.
+func (s *Store) Stats() CacheStats {
+	s.memMu.Lock()
+	defer s.memMu.Unlock()
+	return s.mem.stats()
+}
+
 // вспомогательное
 func ParseNoData(csv string) []float32 {
 	if csv == "" {
@@ -0,0 +1,235 @@
+package ddm
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeTile кладёт синтетический тайл в кэш в раскладке {z}/{y}/{x}.ddm
+func writeTile(t *testing.T, s *Store, z, x, y, gs int, f func(i, j int) float32) {
+	t.Helper()
+	vals := make([]float32, gs*gs)
+	for i := 0; i < gs; i++ {
+		for j := 0; j < gs; j++ {
+			vals[i*gs+j] = f(i, j)
+		}
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, vals); err != nil {
+		t.Fatal(err)
+	}
+	path := s.cachePath(z, x, y)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := NewStore(StoreConfig{
+		CacheDir:     t.TempDir(),
+		DefaultZoom:  10,
+		HeightFactor: 1,
+		NoDataValues: []float32{-32768},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestHeightBatchGroupsByTile(t *testing.T) {
+	s := newTestStore(t)
+	const z = 10
+	pts := []LatLon{
+		{Lat: 24.05, Lon: 55.78},
+		{Lat: 24.06, Lon: 55.79},
+		{Lat: 60, Lon: 10}, // тайла нет
+		{Lat: 95, Lon: 0},  // вне диапазона
+	}
+	x, y := tileXYZ(pts[0].Lat, pts[0].Lon, z)
+	writeTile(t, s, z, x, y, 9, func(i, j int) float32 { return 100 })
+
+	res := s.HeightBatch(context.Background(), pts, z)
+	if len(res) != len(pts) {
+		t.Fatalf("got %d results", len(res))
+	}
+	for i := 0; i < 2; i++ {
+		if res[i].Err != nil || math.Abs(res[i].Height-100) > 1e-6 {
+			t.Errorf("point %d: h=%v err=%v", i, res[i].Height, res[i].Err)
+		}
+	}
+	// оба из одного тайла, который прочитан с диска один раз на группу
+	if res[0].Meta.Source != "disk-cache" || res[1].Meta.Source != "disk-cache" {
+		t.Errorf("sources: %q %q", res[0].Meta.Source, res[1].Meta.Source)
+	}
+	if !errors.Is(res[2].Err, ErrTileNotFound) {
+		t.Errorf("point 2: err=%v", res[2].Err)
+	}
+	if res[3].Err == nil {
+		t.Errorf("point 3: expected range error")
+	}
+
+	// 180° и -180° — один меридиан на западном краю тайла x=0
+	x, y = tileXYZ(10, -180, z)
+	writeTile(t, s, z, x, y, 9, func(i, j int) float32 { return 300 })
+	edge := []LatLon{{Lat: 10, Lon: 180}, {Lat: 10, Lon: -180}}
+	for i, r := range s.HeightBatch(context.Background(), edge, z) {
+		if r.Err != nil || r.Height != 300 || r.Meta.X != 0 {
+			t.Errorf("lon %v: h=%v meta=%+v err=%v", edge[i].Lon, r.Height, r.Meta, r.Err)
+		}
+	}
+	if h, meta, err := s.Height(context.Background(), 10, 180, z); err != nil || h != 300 || meta.X != 0 {
+		t.Errorf("Height at lon 180: h=%v meta=%+v err=%v", h, meta, err)
+	}
+}
+
+func TestOverzoomAndParentFallback(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer upstream.Close()
+
+	s, err := NewStore(StoreConfig{
+		CacheDir:       t.TempDir(),
+		URLTemplate:    upstream.URL + "/{z}/{y}/{x}.ddm",
+		PermitDownload: true,
+		DefaultZoom:    12,
+		MaxNativeZoom:  12,
+		MinZoom:        8,
+		HeightFactor:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lat, lon := 24.05, 55.78
+	x10, y10 := tileXYZ(lat, lon, 10)
+	writeTile(t, s, 10, x10, y10, 9, func(i, j int) float32 { return 42 })
+	ctx := context.Background()
+
+	// z=17 → нативный 12 → нет ни 12, ни 11 → родитель 10
+	h, meta, err := s.Height(ctx, lat, lon, 17)
+	if err != nil || h != 42 {
+		t.Fatalf("h=%v err=%v", h, err)
+	}
+	if meta.Z != 10 || meta.X != x10 || meta.Y != y10 || meta.RequestedZ != 17 {
+		t.Errorf("meta %+v", meta)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("upstream hits %d, want 2 (z12, z11)", n)
+	}
+
+	// 404 запомнены — второй запрос апстрим не трогает
+	res := s.HeightBatch(ctx, []LatLon{{Lat: lat, Lon: lon}}, 0)
+	if res[0].Err != nil || res[0].Meta.Z != 10 || res[0].Meta.RequestedZ != 12 {
+		t.Errorf("batch: %+v", res[0])
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("upstream hits after retry %d", n)
+	}
+
+	// ниже MinZoom не опускаемся
+	if _, meta, err := s.Height(ctx, 60, 10, 0); !errors.Is(err, ErrTileNotFound) || meta.Z != 12 {
+		t.Errorf("missing everywhere: meta=%+v err=%v", meta, err)
+	}
+
+	// запрошенный зум ниже MinZoom — ошибка, а не nil-тайл
+	if _, _, err := s.Height(ctx, lat, lon, 3); !errors.Is(err, ErrTileNotFound) {
+		t.Errorf("below MinZoom: %v", err)
+	}
+	if res := s.HeightBatch(ctx, []LatLon{{Lat: lat, Lon: lon}}, 3); !errors.Is(res[0].Err, ErrTileNotFound) {
+		t.Errorf("batch below MinZoom: %v", res[0].Err)
+	}
+}
+
+func TestConcurrentDownloadDedup(t *testing.T) {
+	var hits atomic.Int32
+	subs := make(map[string]int)
+	var mu sync.Mutex
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		mu.Lock()
+		subs[strings.Split(r.URL.Path, "/")[1]]++
+		mu.Unlock()
+		<-release
+		_, _ = w.Write(make([]byte, 9*9*4))
+	}))
+	defer upstream.Close()
+
+	s, err := NewStore(StoreConfig{
+		CacheDir:       t.TempDir(),
+		URLTemplate:    upstream.URL + "/{s}/{z}/{y}/{x}.ddm",
+		Subdomains:     []string{"a", "b"},
+		PermitDownload: true,
+		DefaultZoom:    10,
+		HeightFactor:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ждущий со своим коротким ctx уходит, но общая загрузка не прерывается
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.Height(short, 24.05, 55.78, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("short ctx: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := s.Height(context.Background(), 24.05, 55.78, 10); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("upstream hits %d, want 1", n)
+	}
+
+	// разные тайлы параллельно: ротация поддоменов без гонок (go test -race)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, _ = s.Height(context.Background(), 24.05, 55.78+float64(i+1)*0.5, 10)
+		}(i)
+	}
+	wg.Wait()
+	if subs["a"] == 0 || subs["b"] == 0 {
+		t.Errorf("subdomains not rotated: %v", subs)
+	}
+
+	tmp, _ := filepath.Glob(filepath.Join(s.cfg.CacheDir, "*", "*", ".*.tmp"))
+	if len(tmp) != 0 {
+		t.Errorf("temp files left: %v", tmp)
+	}
+}
@@ -0,0 +1,81 @@
+package ddm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LZW в варианте TIFF: коды MSB-first, 9..12 бит, ClearCode=256, EOI=257,
+// ширина кода растёт на одну запись раньше ("early change"), поэтому
+// compress/lzw из стандартной библиотеки не подходит.
+
+const (
+	lzwClear = 256
+	lzwEOI   = 257
+	lzwFirst = 258
+	lzwMax   = 4096
+)
+
+// lzwDecode распаковывает не больше limit байт: длиннее — ошибка.
+func lzwDecode(src []byte, limit int) ([]byte, error) {
+	out := make([]byte, 0, min(limit, 4*len(src)))
+	table := make([][]byte, lzwFirst, lzwMax)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+
+	var bitBuf uint32
+	var bitCnt uint
+	pos := 0
+	width := uint(9)
+	readCode := func() (int, bool) {
+		for bitCnt < width {
+			if pos >= len(src) {
+				return 0, false
+			}
+			bitBuf = bitBuf<<8 | uint32(src[pos])
+			pos++
+			bitCnt += 8
+		}
+		code := int(bitBuf>>(bitCnt-width)) & (1<<width - 1)
+		bitCnt -= width
+		return code, true
+	}
+
+	var prev []byte
+	for {
+		code, ok := readCode()
+		if !ok || code == lzwEOI {
+			return out, nil
+		}
+		if code == lzwClear {
+			table = table[:lzwFirst]
+			width = 9
+			prev = nil
+			continue
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table) && (code < 256 || code >= lzwFirst):
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			entry = append(append(make([]byte, 0, len(prev)+1), prev...), prev[0])
+		default:
+			return out, errors.New("lzw: invalid code")
+		}
+		if len(out)+len(entry) > limit {
+			return out, fmt.Errorf("lzw: output exceeds %d bytes", limit)
+		}
+		out = append(out, entry...)
+
+		if prev != nil && len(table) < lzwMax {
+			e := append(append(make([]byte, 0, len(prev)+1), prev...), entry[0])
+			table = append(table, e)
+		}
+		prev = entry
+		if len(table)+1 >= 1<<width && width < 12 {
+			width++
+		}
+	}
+}
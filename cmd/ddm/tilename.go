@@ -1,6 +1,9 @@
 package ddm
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
 type TileName struct {
 	LatDeg int // целая часть южной/северной широты тайла
@@ -9,6 +12,33 @@ type TileName struct {
 	EW     byte
 }
 
+// TileNameFor — градусный тайл SRTM, содержащий точку (по юго-западному углу).
+// Тайлов N90 и E180 нет: северный и восточный край мира — последний ряд N89/E179.
+func TileNameFor(lat, lon float64) TileName {
+	la := min(int(math.Floor(lat)), 89)
+	lo := min(int(math.Floor(lon)), 179)
+	t := TileName{LatDeg: la, LonDeg: lo, NS: 'N', EW: 'E'}
+	if la < 0 {
+		t.LatDeg, t.NS = -la, 'S'
+	}
+	if lo < 0 {
+		t.LonDeg, t.EW = -lo, 'W'
+	}
+	return t
+}
+
+// SouthWest — координаты юго-западного угла тайла.
+func (t TileName) SouthWest() (lat, lon float64) {
+	lat, lon = float64(t.LatDeg), float64(t.LonDeg)
+	if t.NS == 'S' {
+		lat = -lat
+	}
+	if t.EW == 'W' {
+		lon = -lon
+	}
+	return lat, lon
+}
+
 func (t TileName) FileStem() string {
 	// N/S + 2 цифры широты, E/W + 3 цифры долготы
 	return fmt.Sprintf("%c%02d%c%03d", t.NS, t.LatDeg, t.EW, t.LonDeg)
@@ -0,0 +1,109 @@
+package ddm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HandleTile — GET /tiles/{z}/{y}/{x}.ddm: раздача дискового кэша и бандла как тайл-сервер
+// (на промахе тайл качается с апстрима, если это разрешено).
+// Для PNG-источников расширение .png.
+func (s *Server) HandleTile(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	h.Set("Access-Control-Expose-Headers", "ETag, Last-Modified, X-Tile-Source")
+	switch r.Method {
+	case http.MethodOptions:
+		h.Set("Access-Control-Allow-Headers", "If-None-Match, If-Modified-Since, Range")
+		h.Set("Access-Control-Max-Age", "86400")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet, http.MethodHead:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Store == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	format := s.Store.Config().Format
+	z, x, y, err := parseTilePath(r.PathValue("z"), r.PathValue("y"), r.PathValue("file"), format.ext())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	raw, mod, src, err := s.Store.TileRaw(ctx, z, x, y)
+	if err != nil {
+		if errors.Is(err, ErrTileNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "tile fetch failed: "+err.Error(), terrainErrorStatus(err))
+		return
+	}
+	etag := fmt.Sprintf(`"%x-%x"`, len(raw), mod.UnixNano())
+
+	h.Set("X-Tile-Source", src)
+	h.Set("Cache-Control", "public, max-age=86400")
+	if format.ext() == ".png" {
+		h.Set("Content-Type", "image/png")
+	} else {
+		h.Set("Content-Type", "application/octet-stream")
+		h.Add("Vary", "Accept-Encoding")
+		// PNG уже сжат; float32-сетку жмём, если клиент умеет и не просит диапазон
+		if acceptsGzip(r) && r.Header.Get("Range") == "" {
+			var buf bytes.Buffer
+			zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+			_, _ = zw.Write(raw)
+			if err := zw.Close(); err == nil {
+				raw = buf.Bytes()
+				etag = "W/" + etag
+				h.Set("Content-Encoding", "gzip")
+			}
+		}
+	}
+	h.Set("ETag", etag)
+	// ServeContent сам отвечает 304 по If-None-Match / If-Modified-Since и обслуживает HEAD
+	http.ServeContent(w, r, "", mod, bytes.NewReader(raw))
+}
+
+func parseTilePath(zs, ys, file, ext string) (z, x, y int, err error) {
+	xs, ok := strings.CutSuffix(file, ext)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("tile must end with %s", ext)
+	}
+	if z, err = strconv.Atoi(zs); err != nil || z < 0 || z > 22 {
+		return 0, 0, 0, fmt.Errorf("invalid z")
+	}
+	n := 1 << z
+	if x, err = strconv.Atoi(xs); err != nil || x < 0 || x >= n {
+		return 0, 0, 0, fmt.Errorf("invalid x")
+	}
+	if y, err = strconv.Atoi(ys); err != nil || y < 0 || y >= n {
+		return 0, 0, 0, fmt.Errorf("invalid y")
+	}
+	return z, x, y, nil
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, q, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(q, " ", "") != "q=0"
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package ddm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHandleTile(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/10/5/7.ddm" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(make([]byte, 9*9*4))
+	}))
+	defer upstream.Close()
+
+	st, err := NewStore(StoreConfig{
+		CacheDir:       t.TempDir(),
+		URLTemplate:    upstream.URL + "/{z}/{y}/{x}.ddm",
+		PermitDownload: true,
+		DefaultZoom:    10,
+		HeightFactor:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTile(t, st, 10, 3, 4, 9, func(i, j int) float32 { return float32(i*9 + j) })
+	want, _ := os.ReadFile(st.cachePath(10, 3, 4))
+
+	s := &Server{Store: st}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tiles/{z}/{y}/{file}", s.HandleTile)
+	do := func(method, path string, hdr map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for k, v := range hdr {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("GET", "/tiles/10/4/3.ddm", nil)
+	if w.Code != 200 || !bytes.Equal(w.Body.Bytes(), want) {
+		t.Fatalf("plain: %d len=%d", w.Code, w.Body.Len())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") == "" || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("headers: %v", w.Header())
+	}
+	if w.Header().Get("X-Tile-Source") != "disk-cache" {
+		t.Errorf("source %q", w.Header().Get("X-Tile-Source"))
+	}
+
+	if w := do("GET", "/tiles/10/4/3.ddm", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: %d", w.Code)
+	}
+
+	w = do("GET", "/tiles/10/4/3.ddm", map[string]string{"Accept-Encoding": "br, gzip"})
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("gzip not applied: %v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); !bytes.Equal(got, want) {
+		t.Errorf("gzip body differs")
+	}
+	gzEtag := w.Header().Get("ETag")
+	if w := do("GET", "/tiles/10/4/3.ddm", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": gzEtag}); w.Code != http.StatusNotModified {
+		t.Errorf("gzip If-None-Match: %d", w.Code)
+	}
+
+	if w := do("OPTIONS", "/tiles/10/4/3.ddm", nil); w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("preflight: %d %v", w.Code, w.Header())
+	}
+
+	// промах: качаем с апстрима и кладём в кэш
+	if w := do("GET", "/tiles/10/5/7.ddm", nil); w.Code != 200 || w.Body.Len() != 9*9*4 || w.Header().Get("X-Tile-Source") != "download" {
+		t.Errorf("download: %d %v", w.Code, w.Header())
+	}
+	if _, err := os.Stat(st.cachePath(10, 7, 5)); err != nil {
+		t.Errorf("not cached: %v", err)
+	}
+	if w := do("GET", "/tiles/10/5/8.ddm", nil); w.Code != http.StatusNotFound {
+		t.Errorf("upstream 404: %d", w.Code)
+	}
+
+	for _, p := range []string{"/tiles/10/4/3.png", "/tiles/10/4/1024.ddm", "/tiles/23/0/0.ddm", "/tiles/a/4/3.ddm"} {
+		if w := do("GET", p, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d", p, w.Code)
+		}
+	}
+}
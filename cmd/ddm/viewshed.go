@@ -0,0 +1,403 @@
+package ddm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/terrain"
+)
+
+const (
+	maxViewshedSize = 1001 // ячеек по стороне
+
+	CellHidden  uint8 = 0
+	CellVisible uint8 = 1
+	CellUnknown uint8 = 2 // вне радиуса или нет данных
+)
+
+// Алгоритмы viewshed:
+//   - fan: веер лучей с равным шагом по азимуту;
+//   - r2:  лучи к каждой ячейке периметра, ячейки по пути оцениваются по ходу луча;
+//   - r3:  отдельная линия визирования к каждой ячейке (точнее, но O(n³)).
+const (
+	ViewshedFan = "fan"
+	ViewshedR2  = "r2"
+	ViewshedR3  = "r3"
+)
+
+// errViewshedHeight — источник высот вернул ошибку, отличную от «нет данных».
+var errViewshedHeight = errors.New("viewshed: height lookup failed")
+
+type ViewshedParams struct {
+	Lat, Lon       float64
+	ObserverHeight float64 // над землёй, м
+	TargetHeight   float64 // над землёй для проверяемых ячеек, м
+	Radius         float64 // м
+	Resolution     float64 // размер ячейки, м
+	Algorithm      string
+	Curvature      bool
+	Refraction     float64
+	Z              int
+}
+
+// Viewshed — квадратная сетка Size×Size в локальной равнопромежуточной проекции
+// вокруг наблюдателя, строка 0 — север. Наблюдатель в ячейке (Size/2, Size/2).
+type Viewshed struct {
+	Size       int
+	Resolution float64
+	Cells      []uint8 // CellHidden | CellVisible | CellUnknown
+	Heights    []float64
+
+	North, South, West, East float64 // границы по центрам крайних ячеек
+	ObserverAlt              float64 // MSL
+	Visible                  int
+	Algorithm                string
+}
+
+// Viewshed считает видимость ячеек в радиусе от наблюдателя по DDM-тайлам.
+func (s *Store) Viewshed(ctx context.Context, p ViewshedParams) (*Viewshed, error) {
+	return ComputeViewshed(ctx, s, p)
+}
+
+// ComputeViewshed — то же для произвольного источника.
+// Высоты всей сетки берутся одним батчем через HeightBatch.
+func ComputeViewshed(ctx context.Context, b Backend, p ViewshedParams) (*Viewshed, error) {
+	if p.Radius <= 0 || p.Resolution <= 0 {
+		return nil, fmt.Errorf("viewshed: radius and resolution must be > 0")
+	}
+	re := terrain.RadiusOfEarth
+	if p.Curvature {
+		var err error
+		if re, err = terrain.EffectiveRadius(p.Refraction); err != nil {
+			return nil, fmt.Errorf("viewshed: %w", err)
+		}
+	}
+	if p.Algorithm == "" {
+		p.Algorithm = ViewshedR2
+	}
+	switch p.Algorithm {
+	case ViewshedFan, ViewshedR2, ViewshedR3:
+	default:
+		return nil, fmt.Errorf("viewshed: unknown algorithm %q (fan|r2|r3)", p.Algorithm)
+	}
+	// проверяем до перевода в int: огромный radius/res переполнил бы размер сетки
+	if cells := p.Radius / p.Resolution; !(cells <= (maxViewshedSize-1)/2) {
+		return nil, fmt.Errorf("viewshed: grid of %.0f cells per side too large (max %d), increase resolution", 2*math.Ceil(cells)+1, maxViewshedSize)
+	}
+	half := int(math.Ceil(p.Radius / p.Resolution))
+	size := 2*half + 1
+
+	// шаг сетки в градусах
+	dLat := deg(p.Resolution / terrain.RadiusOfEarth)
+	dLon := deg(p.Resolution / (terrain.RadiusOfEarth * math.Cos(rad(p.Lat))))
+
+	v := &Viewshed{
+		Size:       size,
+		Resolution: p.Resolution,
+		Cells:      make([]uint8, size*size),
+		Heights:    make([]float64, size*size),
+		North:      p.Lat + float64(half)*dLat,
+		South:      p.Lat - float64(half)*dLat,
+		West:       p.Lon - float64(half)*dLon,
+		East:       p.Lon + float64(half)*dLon,
+		Algorithm:  p.Algorithm,
+	}
+
+	// границы сетки могут выйти за ±180° — долготу ячеек переносим,
+	// а ячейки за пределами проекции тайлов остаются неизвестными
+	pts := make([]LatLon, size*size)
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			pts[i*size+j] = LatLon{Lat: v.North - float64(i)*dLat, Lon: wrapLon(v.West + float64(j)*dLon)}
+		}
+	}
+	for i, r := range b.HeightBatch(ctx, pts, p.Z) {
+		switch {
+		case pts[i].Lat < minLat || pts[i].Lat > maxLat:
+			v.Heights[i] = math.NaN()
+		case r.Err == nil:
+			v.Heights[i] = r.Height
+		case errors.Is(r.Err, ErrNoData) || errors.Is(r.Err, ErrTileNotFound):
+			v.Heights[i] = math.NaN()
+		default:
+			return nil, fmt.Errorf("%w at %.7f,%.7f: %w", errViewshedHeight, pts[i].Lat, pts[i].Lon, r.Err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	obsGround := v.Heights[half*size+half]
+	if math.IsNaN(obsGround) {
+		return nil, fmt.Errorf("viewshed: no terrain under observer")
+	}
+	v.ObserverAlt = obsGround + p.ObserverHeight
+
+	vs := &viewshedCalc{p: p, v: v, half: half, re: re}
+	for i := range v.Cells {
+		v.Cells[i] = CellUnknown
+	}
+	v.Cells[half*size+half] = CellVisible
+
+	switch p.Algorithm {
+	case ViewshedFan:
+		n := int(math.Ceil(2 * math.Pi * float64(half)))
+		for k := 0; k < n; k++ {
+			az := 2 * math.Pi * float64(k) / float64(n)
+			vs.ray(float64(half)+float64(half)*math.Sin(az), float64(half)-float64(half)*math.Cos(az))
+		}
+	case ViewshedR2:
+		for k := 0; k < size; k++ {
+			vs.ray(float64(k), 0)
+			vs.ray(float64(k), float64(size-1))
+			vs.ray(0, float64(k))
+			vs.ray(float64(size-1), float64(k))
+		}
+	case ViewshedR3:
+		for i := 0; i < size; i++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			for j := 0; j < size; j++ {
+				vs.cell(i, j)
+			}
+		}
+	}
+
+	for _, c := range v.Cells {
+		if c == CellVisible {
+			v.Visible++
+		}
+	}
+	return v, nil
+}
+
+type viewshedCalc struct {
+	p    ViewshedParams
+	v    *Viewshed
+	half int
+	re   float64
+}
+
+// angle — тангенс угла места на высоту h (MSL) на расстоянии d ячеек.
+func (c *viewshedCalc) angle(h, dCells float64) float64 {
+	d := dCells * c.p.Resolution
+	if c.p.Curvature {
+		h -= d * d / (2 * c.re)
+	}
+	return (h - c.v.ObserverAlt) / d
+}
+
+func (c *viewshedCalc) inRadius(dCells float64) bool {
+	return dCells*c.p.Resolution <= c.p.Radius
+}
+
+// ray идёт от наблюдателя к точке (col,row) и размечает ячейки по ходу (fan, r2).
+func (c *viewshedCalc) ray(tcol, trow float64) {
+	size, half := c.v.Size, float64(c.half)
+	dx, dy := tcol-half, trow-half
+	steps := int(math.Ceil(math.Max(math.Abs(dx), math.Abs(dy))))
+	if steps == 0 {
+		return
+	}
+	maxA := math.Inf(-1)
+	prev := -1
+	for k := 1; k <= steps; k++ {
+		f := float64(k) / float64(steps)
+		col := int(math.Round(half + dx*f))
+		row := int(math.Round(half + dy*f))
+		idx := row*size + col
+		if idx == prev {
+			continue
+		}
+		prev = idx
+		d := math.Hypot(float64(col)-half, float64(row)-half)
+		if !c.inRadius(d) {
+			return
+		}
+		h := c.v.Heights[idx]
+		if math.IsNaN(h) {
+			continue
+		}
+		if a := c.angle(h+c.p.TargetHeight, d); a >= maxA {
+			c.v.Cells[idx] = CellVisible
+		} else if c.v.Cells[idx] != CellVisible {
+			c.v.Cells[idx] = CellHidden
+		}
+		maxA = math.Max(maxA, c.angle(h, d))
+	}
+}
+
+// cell — отдельная линия визирования к ячейке (r3), рельеф по пути интерполируется.
+func (c *viewshedCalc) cell(row, col int) {
+	half := float64(c.half)
+	idx := row*c.v.Size + col
+	dx, dy := float64(col)-half, float64(row)-half
+	d := math.Hypot(dx, dy)
+	if d == 0 || !c.inRadius(d) || math.IsNaN(c.v.Heights[idx]) {
+		return
+	}
+	target := c.angle(c.v.Heights[idx]+c.p.TargetHeight, d)
+	steps := int(math.Ceil(d))
+	for k := 1; k < steps; k++ {
+		f := float64(k) / float64(steps)
+		h := c.bilinear(half+dy*f, half+dx*f)
+		if !math.IsNaN(h) && c.angle(h, d*f) > target {
+			c.v.Cells[idx] = CellHidden
+			return
+		}
+	}
+	c.v.Cells[idx] = CellVisible
+}
+
+func (c *viewshedCalc) bilinear(r, cl float64) float64 {
+	size := c.v.Size
+	i, j := int(math.Floor(r)), int(math.Floor(cl))
+	if i >= size-1 {
+		i = size - 2
+	}
+	if j >= size-1 {
+		j = size - 2
+	}
+	fy, fx := r-float64(i), cl-float64(j)
+	h := c.v.Heights
+	a := (1-fx)*h[i*size+j] + fx*h[i*size+j+1]
+	b := (1-fx)*h[(i+1)*size+j] + fx*h[(i+1)*size+j+1]
+	return (1-fy)*a + fy*b
+}
+
+// Image — маска видимости: видимое зелёным, закрытое серым, неизвестное прозрачным.
+func (v *Viewshed) Image() image.Image {
+	pal := color.Palette{
+		CellHidden:  color.NRGBA{R: 64, G: 64, B: 64, A: 160},
+		CellVisible: color.NRGBA{R: 0, G: 200, B: 0, A: 160},
+		CellUnknown: color.NRGBA{},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, v.Size, v.Size), pal)
+	copy(img.Pix, v.Cells)
+	return img
+}
+
+// WorldFile — содержимое .pgw для привязки PNG в EPSG:4326 (как у GDAL/QGIS).
+func (v *Viewshed) WorldFile() string {
+	n := float64(v.Size - 1)
+	dLon := (v.East - v.West) / n
+	dLat := (v.North - v.South) / n
+	return fmt.Sprintf("%.12f\n0\n0\n%.12f\n%.12f\n%.12f\n", dLon, -dLat, v.West, v.North)
+}
+
+// HandleViewshed: GET ?lat=&lon=&h=2&target_h=0&radius=2000&res=10&algo=r2&format=json|png|pgw
+func (s *Server) HandleViewshed(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p := ViewshedParams{
+		ObserverHeight: 2,
+		Radius:         2000,
+		Resolution:     30,
+		Algorithm:      q.Get("algo"),
+		Refraction:     terrain.OpticalRefraction, // наблюдатель по умолчанию — человек
+		Z:              s.defaultZoom(),
+	}
+	var err error
+	if p.Lat, err = queryFloat(q.Get("lat")); err != nil || p.Lat < minLat || p.Lat > maxLat {
+		http.Error(w, "invalid lat", http.StatusBadRequest)
+		return
+	}
+	if p.Lon, err = queryFloat(q.Get("lon")); err != nil || p.Lon < -180 || p.Lon > 180 {
+		http.Error(w, "invalid lon", http.StatusBadRequest)
+		return
+	}
+	floats := []struct {
+		key string
+		dst *float64
+	}{
+		{"h", &p.ObserverHeight}, {"target_h", &p.TargetHeight},
+		{"radius", &p.Radius}, {"res", &p.Resolution}, {"k", &p.Refraction},
+	}
+	for _, f := range floats {
+		if v := q.Get(f.key); v != "" {
+			if *f.dst, err = queryFloat(v); err != nil {
+				http.Error(w, "invalid "+f.key, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if v := q.Get("curvature"); v != "" {
+		if p.Curvature, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid curvature", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("z"); v != "" {
+		if p.Z, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid z", http.StatusBadRequest)
+			return
+		}
+	}
+	if p.Z <= 0 {
+		p.Z = s.defaultZoom()
+	}
+	switch {
+	case p.ObserverHeight < 0 || p.TargetHeight < 0:
+		http.Error(w, "h and target_h must be >= 0", http.StatusBadRequest)
+		return
+	case p.Refraction < 0 || p.Refraction >= 1:
+		http.Error(w, "k must be in [0, 1)", http.StatusBadRequest)
+		return
+	case p.Z > 22:
+		http.Error(w, "z out of range", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	v, err := ComputeViewshed(ctx, s.backend(), p)
+	if err != nil && (errors.Is(err, errViewshedHeight) || ctx.Err() != nil) {
+		http.Error(w, err.Error(), terrainErrorStatus(err))
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bounds := fmt.Sprintf("%.10f,%.10f,%.10f,%.10f", v.West, v.South, v.East, v.North)
+	switch q.Get("format") {
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Bounds", bounds)
+		_ = png.Encode(w, v.Image())
+	case "pgw":
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(v.WorldFile()))
+	case "", "json":
+		rows := make([]string, v.Size)
+		for i := range rows {
+			b := make([]byte, v.Size)
+			for j, c := range v.Cells[i*v.Size : (i+1)*v.Size] {
+				b[j] = "01."[c]
+			}
+			rows[i] = string(b)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"size":         v.Size,
+			"resolution":   v.Resolution,
+			"algorithm":    v.Algorithm,
+			"observer_alt": v.ObserverAlt,
+			"visible":      v.Visible,
+			"bounds":       []float64{v.West, v.South, v.East, v.North},
+			"rows":         rows, // '1' — видно, '0' — закрыто, '.' — неизвестно
+		})
+	default:
+		http.Error(w, "invalid format (json|png|pgw)", http.StatusBadRequest)
+	}
+}
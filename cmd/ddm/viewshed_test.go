@@ -0,0 +1,153 @@
+package ddm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViewshedAlgorithms(t *testing.T) {
+	s := newTestStore(t)
+	const z, lat, lon = 10, 24.05, 55.78
+	x, y := tileXYZ(lat, lon, z)
+	// гребень высотой 1000 м по столбцу восточнее наблюдателя
+	fx, _ := tileFrac(lat, lon, z, x, y)
+	wall := int(fx*256) + 2
+	writeTile(t, s, z, x, y, 257, func(i, j int) float32 {
+		if j == wall {
+			return 1000
+		}
+		return 100
+	})
+
+	for _, algo := range []string{ViewshedFan, ViewshedR2, ViewshedR3} {
+		v, err := s.Viewshed(context.Background(), ViewshedParams{
+			Lat: lat, Lon: lon, ObserverHeight: 2,
+			Radius: 1500, Resolution: 50, Algorithm: algo, Z: z,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", algo, err)
+		}
+		half := v.Size / 2
+		if c := v.Cells[half*v.Size+half-5]; c != CellVisible {
+			t.Errorf("%s: west cell = %d, want visible", algo, c)
+		}
+		if c := v.Cells[half*v.Size+v.Size-2]; c != CellHidden {
+			t.Errorf("%s: cell behind wall = %d, want hidden", algo, c)
+		}
+		if c := v.Cells[0]; c != CellUnknown {
+			t.Errorf("%s: corner outside radius = %d, want unknown", algo, c)
+		}
+	}
+}
+
+// cancelAfter отменяется после n вызовов Err — чтобы попасть внутрь цикла r3.
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestViewshedErrors(t *testing.T) {
+	// южнее 25° у stubBackend ошибка: «нет данных» даёт неизвестные ячейки
+	p := ViewshedParams{Lat: 25.002, Lon: 55, ObserverHeight: 2, Radius: 500, Resolution: 50, Algorithm: ViewshedR3}
+	v, err := ComputeViewshed(context.Background(), &stubBackend{h: 10, err: ErrNoData}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := v.Cells[(v.Size-1)*v.Size+v.Size/2]; c != CellUnknown {
+		t.Errorf("south cell without data = %d, want unknown", c)
+	}
+
+	// прочие ошибки источника не маскируются под «нет данных»
+	boom := errors.New("upstream 500")
+	if _, err := ComputeViewshed(context.Background(), &stubBackend{h: 10, err: boom}, p); !errors.Is(err, boom) {
+		t.Errorf("err=%v, want %v", err, boom)
+	}
+	srv := &Server{Source: &stubBackend{h: 10, err: boom}}
+	w := httptest.NewRecorder()
+	srv.HandleViewshed(w, httptest.NewRequest(http.MethodGet, "/viewshed?lat=25.002&lon=55&radius=500&res=50", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("handler code=%d body=%s", w.Code, w.Body)
+	}
+
+	// огромный радиус не должен переполнять размер сетки
+	for _, huge := range []ViewshedParams{
+		{Lat: 25.002, Lon: 55, Radius: 4.7e18, Resolution: 1},
+		{Lat: 25.002, Lon: 55, Radius: 1e6, Resolution: 1e-300},
+		{Lat: 25.002, Lon: 55, Radius: 501, Resolution: 1},
+	} {
+		if _, err := ComputeViewshed(context.Background(), &stubBackend{h: 10}, huge); err == nil {
+			t.Errorf("radius=%g res=%g accepted", huge.Radius, huge.Resolution)
+		}
+	}
+	curved := p
+	curved.Curvature, curved.Refraction = true, 1
+	if _, err := ComputeViewshed(context.Background(), &stubBackend{h: 10}, curved); err == nil {
+		t.Error("k=1 with curvature accepted")
+	}
+	w = httptest.NewRecorder()
+	srv.HandleViewshed(w, httptest.NewRequest(http.MethodGet, "/viewshed?lat=25.002&lon=55&radius=4.7e18&res=1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("huge radius: code=%d body=%s", w.Code, w.Body)
+	}
+
+	for _, q := range []string{"k=1.5", "k=-0.1", "h=-2", "target_h=-1", "z=23"} {
+		w = httptest.NewRecorder()
+		srv.HandleViewshed(w, httptest.NewRequest(http.MethodGet, "/viewshed?lat=25.002&lon=55&radius=500&res=50&"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code=%d body=%s", q, w.Code, w.Body)
+		}
+	}
+
+	ctx := &cancelAfter{Context: context.Background(), n: 2}
+	if _, err := ComputeViewshed(ctx, &stubBackend{h: 10}, p); !errors.Is(err, context.Canceled) {
+		t.Errorf("r3 ignores cancellation: err=%v", err)
+	}
+}
+
+// rangeBackend, как Store, не принимает координаты за пределами проекции
+type rangeBackend struct{ stubBackend }
+
+func (b *rangeBackend) HeightBatch(ctx context.Context, pts []LatLon, z int) []PointResult {
+	out := b.stubBackend.HeightBatch(ctx, pts, z)
+	for i, p := range pts {
+		if p.Lat < minLat || p.Lat > maxLat || p.Lon < -180 || p.Lon > 180 {
+			out[i].Err = fmt.Errorf("coordinates out of range")
+		}
+	}
+	return out
+}
+
+func TestViewshedEdges(t *testing.T) {
+	b := &rangeBackend{stubBackend{h: 10}}
+	v, err := ComputeViewshed(context.Background(), b, ViewshedParams{
+		Lat: 60, Lon: 179.99, ObserverHeight: 2, Radius: 2000, Resolution: 100,
+	})
+	if err != nil {
+		t.Fatalf("antimeridian: %v", err)
+	}
+	half := v.Size / 2
+	if c := v.Cells[half*v.Size+v.Size-2]; c != CellVisible {
+		t.Errorf("cell east of 180 = %d, want visible", c)
+	}
+
+	v, err = ComputeViewshed(context.Background(), b, ViewshedParams{
+		Lat: 85.04, Lon: 10, ObserverHeight: 2, Radius: 2000, Resolution: 100,
+	})
+	if err != nil {
+		t.Fatalf("near pole: %v", err)
+	}
+	if c := v.Cells[half]; c != CellUnknown {
+		t.Errorf("cell north of %g = %d, want unknown", maxLat, c)
+	}
+}
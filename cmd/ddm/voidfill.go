@@ -0,0 +1,150 @@
+package ddm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// FillMethod — как заполнять nodata-узлы тайла при загрузке.
+type FillMethod string
+
+const (
+	FillNone    FillMethod = "none"
+	FillNearest FillMethod = "nearest" // ближайший валидный узел
+	FillIDW     FillMethod = "idw"     // обратные квадраты расстояний по валидным узлам в радиусе
+	FillLaplace FillMethod = "laplace" // гармоническое продолжение с краёв дырки (Гаусс-Зейдель)
+)
+
+// DefaultFillRadius — радиус поиска валидных узлов, в узлах сетки.
+const DefaultFillRadius = 8
+
+func ParseFillMethod(s string) (FillMethod, error) {
+	switch m := FillMethod(strings.ToLower(strings.TrimSpace(s))); m {
+	case "", FillNone:
+		return FillNone, nil
+	case FillNearest, FillIDW, FillLaplace:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown void fill %q (none|nearest|idw|laplace)", s)
+	}
+}
+
+func (t *tileData) isFilled(i, j int) bool {
+	if t.Filled == nil {
+		return false
+	}
+	gs := t.GridSize
+	return t.Filled[min(max(i, 0), gs-1)*gs+min(max(j, 0), gs-1)]
+}
+
+// fillVoids заполняет nodata-узлы, у которых есть валидный узел не дальше
+// radius; более глубокие дыры остаются nodata. Возвращает число заполненных.
+func (t *tileData) fillVoids(m FillMethod, radius int) int {
+	if m == "" || m == FillNone {
+		return 0
+	}
+	if radius <= 0 {
+		radius = DefaultFillRadius
+	}
+	gs := t.GridSize
+	void := make([]bool, len(t.Values))
+	var holes []int
+	for k, v := range t.Values {
+		if _, nd := t.NoDataSet[v]; nd {
+			void[k] = true
+			holes = append(holes, k)
+		}
+	}
+	if len(holes) == 0 || len(holes) == len(t.Values) {
+		return 0
+	}
+
+	// для каждой дырки — ближайший валидный и IDW по валидным в радиусе;
+	// считаем по исходной маске, чтобы результат не зависел от порядка обхода
+	r2 := radius * radius
+	fill := make(map[int]float32, len(holes))
+	for _, k := range holes {
+		i, j := k/gs, k%gs
+		best, bestD := float32(0), math.MaxInt
+		var sum, wsum float64
+		for di := -radius; di <= radius; di++ {
+			ii := i + di
+			if ii < 0 || ii >= gs {
+				continue
+			}
+			for dj := -radius; dj <= radius; dj++ {
+				jj := j + dj
+				d := di*di + dj*dj
+				if jj < 0 || jj >= gs || d > r2 || void[ii*gs+jj] {
+					continue
+				}
+				v := t.Values[ii*gs+jj]
+				if d < bestD {
+					best, bestD = v, d
+				}
+				sum += float64(v) / float64(d)
+				wsum += 1 / float64(d)
+			}
+		}
+		if wsum == 0 {
+			continue // глубже радиуса
+		}
+		if m == FillNearest {
+			fill[k] = best
+		} else {
+			fill[k] = float32(sum / wsum)
+		}
+	}
+	if len(fill) == 0 {
+		return 0
+	}
+
+	t.Filled = make([]bool, len(t.Values))
+	for k, v := range fill {
+		t.Values[k] = v
+		t.Filled[k] = true
+	}
+	if m == FillLaplace {
+		t.relaxLaplace(void)
+	}
+	return len(fill)
+}
+
+// relaxLaplace — Гаусс-Зейдель по заполненным узлам (старт с IDW): каждый
+// становится средним своих соседей, исходные валидные узлы — граничное условие.
+func (t *tileData) relaxLaplace(void []bool) {
+	gs := t.GridSize
+	for it := 0; it < 500; it++ {
+		var maxDelta float64
+		for k, f := range t.Filled {
+			if !f {
+				continue
+			}
+			i, j := k/gs, k%gs
+			var sum float64
+			var n int
+			for _, d := range [4][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				ii, jj := i+d[0], j+d[1]
+				if ii < 0 || jj < 0 || ii >= gs || jj >= gs {
+					continue
+				}
+				kk := ii*gs + jj
+				if void[kk] && !t.Filled[kk] {
+					continue // незаполненная глубокая дыра
+				}
+				sum += float64(t.Values[kk])
+				n++
+			}
+			if n == 0 {
+				continue
+			}
+			v := sum / float64(n)
+			maxDelta = math.Max(maxDelta, math.Abs(v-float64(t.Values[k])))
+			t.Values[k] = float32(v)
+		}
+		if maxDelta < 1e-3 {
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ddm
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+const testVoid = -32768
+
+func rampTile(gs int, hole func(i, j int) bool) *tileData {
+	vals := make([]float32, gs*gs)
+	for i := 0; i < gs; i++ {
+		for j := 0; j < gs; j++ {
+			vals[i*gs+j] = float32(10*i + j)
+			if hole(i, j) {
+				vals[i*gs+j] = testVoid
+			}
+		}
+	}
+	return &tileData{GridSize: gs, Values: vals, NoDataSet: map[float32]struct{}{testVoid: {}}, Factor: 1}
+}
+
+func TestFillVoids(t *testing.T) {
+	const gs = 21
+	// дырка 5x5 в центре и глубокая 15x3 у края, до которой радиус 1 не дотянется
+	hole := func(i, j int) bool {
+		return (i >= 8 && i <= 12 && j >= 8 && j <= 12) || (j <= 2 && i >= 3 && i <= 17)
+	}
+
+	for _, tc := range []struct {
+		m   FillMethod
+		tol float64
+	}{
+		{FillNearest, 30},
+		{FillIDW, 20},       // на склоне IDW тянет к ближнему краю дырки
+		{FillLaplace, 0.05}, // для линейной поверхности гармоническое продолжение точно
+	} {
+		td := rampTile(gs, hole)
+		n := td.fillVoids(tc.m, 3)
+		if n != 25+15*3 {
+			t.Errorf("%s: filled %d", tc.m, n)
+		}
+		for i := 8; i <= 12; i++ {
+			for j := 8; j <= 12; j++ {
+				v, ok := td.node(i, j)
+				if !ok || !td.isFilled(i, j) || math.Abs(float64(v)-float64(10*i+j)) > tc.tol {
+					t.Errorf("%s: (%d,%d)=%v ok=%v", tc.m, i, j, v, ok)
+				}
+			}
+		}
+		if td.isFilled(0, 0) || td.isFilled(5, 5) {
+			t.Errorf("%s: valid node marked filled", tc.m)
+		}
+	}
+
+	// радиус 1: внутренности дыр остаются nodata
+	td := rampTile(gs, hole)
+	td.fillVoids(FillIDW, 1)
+	if _, ok := td.node(10, 10); ok {
+		t.Error("center of 5x5 hole filled with radius 1")
+	}
+	if _, ok := td.node(8, 8); !ok {
+		t.Error("rim of the hole not filled")
+	}
+
+	if _, err := ParseFillMethod("kriging"); err == nil {
+		t.Error("expected unknown fill error")
+	}
+}
+
+func TestStoreVoidFillReported(t *testing.T) {
+	s, err := NewStore(StoreConfig{
+		CacheDir:     t.TempDir(),
+		DefaultZoom:  10,
+		HeightFactor: 1,
+		NoDataValues: []float32{testVoid},
+		VoidFill:     FillLaplace,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const z, gs = 10, 9
+	x, y := tileXYZ(24.05, 55.78, z)
+	writeTile(t, s, z, x, y, gs, func(i, j int) float32 {
+		if i >= 3 && i <= 5 && j >= 3 && j <= 5 {
+			return testVoid
+		}
+		return float32(100 + i)
+	})
+	ctx := context.Background()
+
+	lat, lon := tileFracToLatLon(z, x, y, 0.5, 0.5) // центр дырки
+	h, meta, err := s.Height(ctx, lat, lon, z)
+	if err != nil || math.Abs(h-104) > 0.05 || !meta.Filled {
+		t.Errorf("in hole: h=%v meta=%+v err=%v", h, meta, err)
+	}
+	lat, lon = tileFracToLatLon(z, x, y, 0.1, 0.1)
+	if _, meta, err := s.Height(ctx, lat, lon, z); err != nil || meta.Filled {
+		t.Errorf("outside hole: meta=%+v err=%v", meta, err)
+	}
+}
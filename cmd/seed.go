@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pavletto/altituder/cmd/ddm"
+	"github.com/spf13/cobra"
+)
+
+// seedCmd заранее скачивает тайлы района в кэш — для работы без связи
+var seedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "Prefetch DDM tiles for an area into the cache before going offline",
+	Long: `Downloads every tile of the zoom range that touches the area into
+DDM_CACHE_DIR, using the same DDM_* settings as serve. Tiles already on disk
+are skipped, so an interrupted run is resumed by running it again.
+
+  seed --bbox 24,55,26,57 --min-z 10 --max-z 14
+  seed --geojson field.geojson --max-z 14            (Polygon/MultiPolygon)
+  seed --geojson plan.geojson --buffer 2000          (LineString: corridor)
+  seed --corridor "24.05,55.78;24.30,55.95" --buffer 1000 --rate 20`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := cmd.Flags()
+		area, err := seedArea(cmd)
+		if err != nil {
+			return err
+		}
+		if area == nil {
+			return fmt.Errorf("one of --bbox, --geojson, --corridor required")
+		}
+		cfg, err := storeConfigFromEnv()
+		if err != nil {
+			return err
+		}
+		if dir, _ := f.GetString("dir"); dir != "" {
+			cfg.CacheDir = dir
+		}
+
+		var sc ddm.SeedConfig
+		sc.MinZoom, _ = f.GetInt("min-z")
+		sc.MaxZoom, _ = f.GetInt("max-z")
+		if sc.MaxZoom < 0 {
+			sc.MaxZoom = cfg.DefaultZoom
+		}
+		if sc.MinZoom < 0 {
+			sc.MinZoom = sc.MaxZoom
+		}
+		sc.Workers, _ = f.GetInt("workers")
+		sc.Rate, _ = f.GetFloat64("rate")
+		sc.Refresh, _ = f.GetBool("refresh")
+
+		if dry, _ := f.GetBool("dry-run"); dry {
+			tiles, err := ddm.SeedTiles(area, sc.MinZoom, sc.MaxZoom)
+			if err != nil {
+				return err
+			}
+			perZ := make(map[int]int)
+			for _, t := range tiles {
+				perZ[t.Z]++
+			}
+			for z := sc.MinZoom; z <= sc.MaxZoom; z++ {
+				fmt.Fprintf(cmd.OutOrStdout(), "  z%-2d %d\n", z, perZ[z])
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d tiles\n", len(tiles))
+			return nil
+		}
+
+		store, err := ddm.NewStore(cfg)
+		if err != nil {
+			return err
+		}
+		last := time.Now()
+		sc.Progress = func(st ddm.SeedStats) {
+			if st.Done == st.Total || time.Since(last) > time.Second {
+				last = time.Now()
+				log.Printf("%d/%d tiles (downloaded=%d existed=%d missing=%d failed=%d)",
+					st.Done, st.Total, st.Downloaded, st.Existed, st.Missing, st.Failed)
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		start := time.Now()
+		st, err := store.Seed(ctx, area, sc)
+		log.Printf("downloaded=%d existed=%d missing=%d failed=%d total=%d in %s",
+			st.Downloaded, st.Existed, st.Missing, st.Failed, st.Total, time.Since(start).Round(time.Millisecond))
+		return err
+	},
+}
+
+// seedArea — не больше одного из --bbox, --geojson, --corridor; ни одного — nil.
+func seedArea(cmd *cobra.Command) (ddm.Area, error) {
+	f := cmd.Flags()
+	bboxStr, _ := f.GetString("bbox")
+	geoPath, _ := f.GetString("geojson")
+	corridor, _ := f.GetString("corridor")
+	buffer, _ := f.GetFloat64("buffer")
+
+	n := 0
+	for _, v := range []string{bboxStr, geoPath, corridor} {
+		if v != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("only one of --bbox, --geojson, --corridor allowed")
+	}
+	switch {
+	case n == 0:
+		return nil, nil
+	case bboxStr != "":
+		return ddm.ParseBBox(bboxStr)
+	case geoPath != "":
+		raw, err := os.ReadFile(geoPath)
+		if err != nil {
+			return nil, err
+		}
+		return ddm.ParseGeoJSONArea(raw, buffer)
+	default:
+		path, err := parseLatLonList(corridor)
+		if err != nil {
+			return nil, err
+		}
+		return ddm.Corridor{Path: path, BufferM: buffer}, nil
+	}
+}
+
+// parseLatLonList разбирает "lat,lon;lat,lon;...".
+func parseLatLonList(s string) ([]ddm.LatLon, error) {
+	var out []ddm.LatLon
+	for _, p := range strings.Split(s, ";") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		f := strings.Split(p, ",")
+		if len(f) != 2 {
+			return nil, fmt.Errorf("corridor point needs lat,lon: %q", p)
+		}
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(f[0]), 64)
+		lon, err2 := strconv.ParseFloat(strings.TrimSpace(f[1]), 64)
+		if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("bad corridor point %q", p)
+		}
+		out = append(out, ddm.LatLon{Lat: lat, Lon: lon})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("empty corridor")
+	}
+	return out, nil
+}
+
+// addAreaFlags — флаги района, общие для seed и bundle export.
+func addAreaFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.String("bbox", "", "south,west,north,east in degrees")
+	f.String("geojson", "", "GeoJSON file: polygons as is, lines and points as a corridor of --buffer")
+	f.String("corridor", "", `flight plan "lat,lon;lat,lon;..."`)
+	f.Float64("buffer", 500, "corridor half-width, m")
+}
+
+func init() {
+	addAreaFlags(seedCmd)
+	f := seedCmd.Flags()
+	f.Int("min-z", -1, "min zoom (default: --max-z)")
+	f.Int("max-z", -1, "max zoom (default: DDM_DEFAULT_Z)")
+	f.Int("workers", 4, "parallel downloads")
+	f.Float64("rate", 0, "max downloads per second (0 = unlimited)")
+	f.Bool("refresh", false, "download again tiles already in the cache")
+	f.Bool("dry-run", false, "only count tiles per zoom")
+	f.String("dir", "", "cache directory (default: DDM_CACHE_DIR)")
+	rootCmd.AddCommand(seedCmd)
+}
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"github.com/pavletto/altituder/cmd/ddm"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -33,24 +36,9 @@ var serveCmd = &cobra.Command{
 	Short: "Hello World web server",
 	Long:  `Hello World web server`,
 	Run: func(cmd *cobra.Command, args []string) {
-		cacheDir := getenv("DDM_CACHE_DIR", "./cache")
-		urlTpl := getenv("DDM_URL_TEMPLATE", "https://{s}.geodata.microavia.com/srtm/{z}/{y}/{x}.ddm")
-		subs := getenv("DDM_SUBDOMAINS", "a,b,c")
-		heightFactor := getenvFloat("DDM_HEIGHT_FACTOR", 1.0)
-		defaultZoom := getenvInt("DDM_DEFAULT_Z", 14) // как в вашем примере maxZoom=17
-		maxNativeZoom := getenvInt("DDM_MAX_NATIVE_Z", 14)
-		noDataCSV := os.Getenv("DDM_NODATA_CSV") // например: "-32768,3.4028235e+38"
-
-		cfg := ddm.StoreConfig{
-			CacheDir:          cacheDir,
-			URLTemplate:       urlTpl,
-			Subdomains:        strings.Split(subs, ","),
-			PermitDownload:    urlTpl != "",
-			HTTPClientTimeout: 15 * time.Second,
-			DefaultZoom:       defaultZoom,
-			MaxNativeZoom:     maxNativeZoom,
-			HeightFactor:      float32(heightFactor),
-			NoDataValues:      ddm.ParseNoData(noDataCSV),
+		cfg, err := storeConfigFromEnv()
+		if err != nil {
+			log.Fatal(err)
 		}
 
 		store, err := ddm.NewStore(cfg)
@@ -60,17 +48,157 @@ var serveCmd = &cobra.Command{
 
 		s := &ddm.Server{Store: store}
 
+		// источник высот: ddm (тайл-сервер + кэш) | hgt (локальные SRTM) | geotiff (один растр) | bundle (tar-бандл)
+		// | layers (по приоритету из ELEV_LAYERS, например "survey=geotiff:/data/s.tif@24.9,55.6,25.1,55.9;ddm;hgt:./srtm";
+		//   ddm без аргумента — основной DDM_*-источник, "ddm:[формат:]URL" — отдельный тайловый)
+		backend := getenv("ELEV_BACKEND", "ddm")
+		if backend == "layers" {
+			specs, err := ddm.ParseLayers(getenv("ELEV_LAYERS", "ddm"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			c := &ddm.Composite{}
+			for _, sp := range specs {
+				b, err := openBackend(store, sp.Kind, sp.Arg)
+				if err != nil {
+					log.Fatalf("layer %s: %v", sp.Name, err)
+				}
+				c.Layers = append(c.Layers, ddm.Layer{Name: sp.Name, Backend: b, BBox: sp.BBox})
+			}
+			s.Source = c
+		} else {
+			b, err := openBackend(store, backend, "")
+			if err != nil {
+				log.Fatal(err)
+			}
+			s.Source = b
+		}
+
 		mux := http.NewServeMux()
 		mux.HandleFunc("/intersection", s.HandleIntersection)
+		mux.HandleFunc("/footprint", s.HandleFootprint)
+		mux.HandleFunc("/pixel", s.HandlePixel)
+		mux.HandleFunc("/reproject", s.HandleReproject)
 		mux.HandleFunc("/height", s.HandleHeight)
+		mux.HandleFunc("/height/batch", s.HandleHeightBatch)
+		mux.HandleFunc("/profile", s.HandleProfile)
+		mux.HandleFunc("/los", s.HandleLOS)
+		mux.HandleFunc("/viewshed", s.HandleViewshed)
+		mux.HandleFunc("/tiles/{z}/{y}/{file}", s.HandleTile) // {x}.ddm | {x}.png
+		mux.HandleFunc("/stats", s.HandleStats)
+		mux.HandleFunc("/seed", s.HandleSeed)         // POST — предзагрузка района, GET — задания
+		mux.HandleFunc("/seed/{id}", s.HandleSeedJob) // прогресс / DELETE — отмена
 		mux.HandleFunc("/health", s.HandleHealth)
 
 		addr := getenv("ADDR", ":8080")
-		log.Printf("listening on %s cache=%s download=%v tpl=%s", addr, cacheDir, cfg.PermitDownload, urlTpl)
+		log.Printf("listening on %s backend=%s cache=%s download=%v tpl=%s format=%s", addr, backend, cfg.CacheDir, cfg.PermitDownload, cfg.URLTemplate, cfg.Format)
 		log.Fatal(http.ListenAndServe(addr, mux))
 	},
 }
 
+// storeConfigFromEnv собирает настройки DDM-тайлов из DDM_* (общие для serve и seed).
+func storeConfigFromEnv() (ddm.StoreConfig, error) {
+	cacheDir := getenv("DDM_CACHE_DIR", "./cache")
+	urlTpl := getenv("DDM_URL_TEMPLATE", "https://{s}.geodata.microavia.com/srtm/{z}/{y}/{x}.ddm")
+	subs := getenv("DDM_SUBDOMAINS", "a,b,c")
+	heightFactor := getenvFloat("DDM_HEIGHT_FACTOR", 1.0)
+	defaultZoom := getenvInt("DDM_DEFAULT_Z", 14) // как в вашем примере maxZoom=17
+	maxNativeZoom := getenvInt("DDM_MAX_NATIVE_Z", 14)
+	minZoom := getenvInt("DDM_MIN_Z", 0)     // до какого зума откатываться, если тайла нет
+	noDataCSV := os.Getenv("DDM_NODATA_CSV") // например: "-32768,3.4028235e+38"
+
+	// кодировка тайлов: ddm | terrain-rgb | terrarium
+	format, err := ddm.ParseTileFormat(getenv("DDM_FORMAT", "ddm"))
+	if err != nil {
+		return ddm.StoreConfig{}, err
+	}
+	// интерполяция по умолчанию: nearest | bilinear | bicubic | idw (на запрос — ?interp=)
+	interp, err := ddm.ParseInterp(getenv("DDM_INTERP", "bilinear"))
+	if err != nil {
+		return ddm.StoreConfig{}, err
+	}
+	// заделка дыр при загрузке тайла: none | nearest | idw | laplace
+	voidFill, err := ddm.ParseFillMethod(getenv("DDM_VOID_FILL", "none"))
+	if err != nil {
+		return ddm.StoreConfig{}, err
+	}
+
+	return ddm.StoreConfig{
+		CacheDir:          cacheDir,
+		URLTemplate:       urlTpl,
+		Format:            format,
+		Interp:            interp,
+		VoidFill:          voidFill,
+		VoidFillRadius:    getenvInt("DDM_VOID_FILL_RADIUS", ddm.DefaultFillRadius),
+		MaxMemTiles:       getenvInt("DDM_MEM_TILES", 0),
+		MaxMemBytes:       int64(getenvInt("DDM_MEM_MB", 256)) << 20, // бюджет памяти под тайлы
+		MaxDiskBytes:      int64(getenvInt("DDM_DISK_MAX_MB", 0)) << 20,
+		MaxDiskAge:        getenvDuration("DDM_DISK_MAX_AGE", 0), // например 720h
+		DiskTTL:           getenvDuration("DDM_DISK_TTL", 0),     // перепроверка тайла у апстрима
+		Subdomains:        strings.Split(subs, ","),
+		PermitDownload:    urlTpl != "",
+		HTTPClientTimeout: 15 * time.Second,
+		DefaultZoom:       defaultZoom,
+		MaxNativeZoom:     maxNativeZoom,
+		MinZoom:           minZoom,
+		HeightFactor:      float32(heightFactor),
+		NoDataValues:      ddm.ParseNoData(noDataCSV),
+		Bundle:            os.Getenv("DDM_BUNDLE"), // tar-бандл из `bundle export`, читается после дискового кэша
+	}, nil
+}
+
+// openBackend открывает одиночный источник; пустой arg — путь из переменных окружения.
+func openBackend(store *ddm.Store, kind, arg string) (ddm.Backend, error) {
+	switch kind {
+	case "ddm":
+		if arg == "" {
+			return store, nil
+		}
+		return openTileLayer(store.Config(), arg)
+	case "hgt":
+		if arg == "" {
+			arg = getenv("HGT_DIR", "./srtm")
+		}
+		return ddm.NewHGTStore(arg, getenvInt("HGT_MAX_TILES", 16), int64(getenvInt("HGT_MEM_MB", 256))<<20)
+	case "geotiff":
+		if arg == "" {
+			arg = getenv("GEOTIFF_PATH", "./dem.tif")
+		}
+		return ddm.OpenGeoTIFF(arg)
+	case "bundle":
+		if arg == "" {
+			arg = getenv("BUNDLE_PATH", "./tiles.tar")
+		}
+		// только бандл: без диска и загрузки, формат берётся из индекса
+		cfg := store.Config()
+		cfg.Bundle, cfg.CacheDir, cfg.Format = arg, "", ""
+		return ddm.NewStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown elevation backend %q (ddm|hgt|geotiff|bundle|layers)", kind)
+	}
+}
+
+// openTileLayer — отдельный тайловый Store для слоя "ddm:[формат:]шаблон URL",
+// например "ddm:terrain-rgb:https://api.example.com/{z}/{x}/{y}.png".
+// Без формата берётся DDM_FORMAT. Дисковый кэш — свой подкаталог на каждый шаблон,
+// чтобы тайлы разных источников и кодировок не смешивались.
+func openTileLayer(cfg ddm.StoreConfig, arg string) (*ddm.Store, error) {
+	if f, rest, ok := strings.Cut(arg, ":"); ok {
+		if format, err := ddm.ParseTileFormat(f); err == nil {
+			cfg.Format, arg = format, rest
+		}
+	}
+	if !strings.Contains(arg, "{z}") || !strings.Contains(arg, "{x}") || !strings.Contains(arg, "{y}") {
+		return nil, fmt.Errorf("ddm layer: %q is not a tile URL template with {z}/{x}/{y}", arg)
+	}
+	cfg.URLTemplate, cfg.PermitDownload, cfg.Bundle = arg, true, ""
+	if cfg.CacheDir != "" {
+		sum := sha1.Sum([]byte(string(cfg.Format) + " " + arg))
+		cfg.CacheDir = filepath.Join(cfg.CacheDir, ddm.LayerCacheDir, hex.EncodeToString(sum[:6]))
+	}
+	return ddm.NewStore(cfg)
+}
+
 func getenv(k, d string) string {
 	if v := os.Getenv(k); v != "" {
 		return v
@@ -93,6 +221,14 @@ func getenvFloat(k string, d float64) float64 {
 	}
 	return d
 }
+func getenvDuration(k string, d time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if t, err := time.ParseDuration(v); err == nil {
+			return t
+		}
+	}
+	return d
+}
 func init() {
 	rootCmd.AddCommand(serveCmd)
 }
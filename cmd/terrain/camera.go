@@ -0,0 +1,110 @@
+package terrain
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Intrinsics — pinhole-камера с дисторсией Brown–Conrady в порядке OpenCV (k1,k2,p1,p2,k3).
+// Оптическая СК: Z вперёд, X вправо, Y вниз — совпадает с осями X/Y/Z корпуса FRD.
+type Intrinsics struct {
+	Fx, Fy float64 // фокусное расстояние, пиксели
+	Cx, Cy float64 // главная точка, пиксели
+
+	K1, K2, K3 float64
+	P1, P2     float64
+}
+
+func (in Intrinsics) Validate() error {
+	if in.Fx <= 0 || in.Fy <= 0 {
+		return fmt.Errorf("camera: fx and fy must be > 0")
+	}
+	return nil
+}
+
+func (in Intrinsics) hasDistortion() bool {
+	return in.K1 != 0 || in.K2 != 0 || in.K3 != 0 || in.P1 != 0 || in.P2 != 0
+}
+
+// Undistort переводит пиксель в нормализованные координаты без дисторсии
+// (итерационно, как cv::undistortPoints).
+func (in Intrinsics) Undistort(u, v float64) (x, y float64) {
+	x0 := (u - in.Cx) / in.Fx
+	y0 := (v - in.Cy) / in.Fy
+	x, y = x0, y0
+	if !in.hasDistortion() {
+		return x, y
+	}
+	for i := 0; i < 20; i++ {
+		r2 := x*x + y*y
+		radial := 1 + in.K1*r2 + in.K2*r2*r2 + in.K3*r2*r2*r2
+		dx := 2*in.P1*x*y + in.P2*(r2+2*x*x)
+		dy := in.P1*(r2+2*y*y) + 2*in.P2*x*y
+		x = (x0 - dx) / radial
+		y = (y0 - dy) / radial
+	}
+	return x, y
+}
+
+// Distort — обратное к Undistort: нормализованные координаты → пиксель.
+func (in Intrinsics) Distort(x, y float64) (u, v float64) {
+	if in.hasDistortion() {
+		r2 := x*x + y*y
+		radial := 1 + in.K1*r2 + in.K2*r2*r2 + in.K3*r2*r2*r2
+		x, y = x*radial+2*in.P1*x*y+in.P2*(r2+2*x*x),
+			y*radial+in.P1*(r2+2*y*y)+2*in.P2*x*y
+	}
+	return in.Fx*x + in.Cx, in.Fy*y + in.Cy
+}
+
+// PixelRay — направление луча через пиксель (u,v) в связанной СК камеры.
+func (in Intrinsics) PixelRay(u, v float64) [3]float64 {
+	x, y := in.Undistort(u, v)
+	return [3]float64{1, x, y}
+}
+
+// EulerToQuat — углы roll/pitch/yaw (рад, порядок ZYX как в PX4) в кватернион w,x,y,z.
+func EulerToQuat(roll, pitch, yaw float64) [4]float64 {
+	cr, sr := math.Cos(roll/2), math.Sin(roll/2)
+	cp, sp := math.Cos(pitch/2), math.Sin(pitch/2)
+	cy, sy := math.Cos(yaw/2), math.Sin(yaw/2)
+	return [4]float64{
+		cr*cp*cy + sr*sp*sy,
+		sr*cp*cy - cr*sp*sy,
+		cr*sp*cy + sr*cp*sy,
+		cr*cp*sy - sr*sp*cy,
+	}
+}
+
+// QuatConj — сопряжённый кватернион (обратный поворот для единичного q).
+func QuatConj(q [4]float64) [4]float64 {
+	return [4]float64{q[0], -q[1], -q[2], -q[3]}
+}
+
+// QuatMul — произведение Гамильтона a⊗b: сначала поворот b, затем a.
+func QuatMul(a, b [4]float64) [4]float64 {
+	return [4]float64{
+		a[0]*b[0] - a[1]*b[1] - a[2]*b[2] - a[3]*b[3],
+		a[0]*b[1] + a[1]*b[0] + a[2]*b[3] - a[3]*b[2],
+		a[0]*b[2] - a[1]*b[3] + a[2]*b[0] + a[3]*b[1],
+		a[0]*b[3] + a[1]*b[2] - a[2]*b[1] + a[3]*b[0],
+	}
+}
+
+type PixelRaycastParams struct {
+	RaycastParams
+	Camera Intrinsics
+	U, V   float64 // пиксель
+}
+
+// PixelToGround находит точку на рельефе, которую видит пиксель (u,v).
+// Подвес и монтаж берутся из RaycastParams.Mount, луч строится по intrinsics.
+func PixelToGround(ctx context.Context, p PixelRaycastParams) (RaycastResult, error) {
+	if err := p.Camera.Validate(); err != nil {
+		return RaycastResult{}, err
+	}
+	rp := p.RaycastParams
+	rp.Body = p.Camera.PixelRay(p.U, p.V)
+	return Trace(ctx, rp)
+}
@@ -0,0 +1,82 @@
+package terrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Камера смотрит вдоль оси X связанной СК: вправо по кадру — +Y, вниз по кадру — +Z.
+
+type FootprintParams struct {
+	RaycastParams
+	HFOV, VFOV    float64 // градусы; если задана одна, вторая считается по Width/Height
+	Width, Height int     // размер кадра в пикселях
+}
+
+// Footprint — проекция кадра на рельеф. Углы по часовой от левого верхнего.
+type Footprint struct {
+	Center  RaycastResult
+	Corners [4]RaycastResult // TL, TR, BR, BL
+	HFOV    float64
+	VFOV    float64
+}
+
+// Complete — все четыре угла попали в землю (иначе полигон замкнут по концам лучей
+// или по точкам, где кончились данные рельефа — у таких Unknown=true).
+func (f Footprint) Complete() bool {
+	for _, c := range f.Corners {
+		if !c.Hit {
+			return false
+		}
+	}
+	return true
+}
+
+// CameraFootprint бросает лучи через центр и четыре угла кадра.
+// Нехватка данных рельефа по отдельному лучу не ошибка: луч помечается Unknown.
+func CameraFootprint(ctx context.Context, p FootprintParams) (Footprint, error) {
+	h, v, err := p.FOV()
+	if err != nil {
+		return Footprint{}, err
+	}
+	th := math.Tan(h * math.Pi / 360)
+	tv := math.Tan(v * math.Pi / 360)
+
+	f := Footprint{HFOV: h, VFOV: v}
+	rp := p.RaycastParams
+	rp.Body = [3]float64{1, 0, 0}
+	if f.Center, err = Trace(ctx, rp); err != nil && !errors.Is(err, ErrUnknownTerrain) {
+		return f, err
+	}
+	for i, c := range [4][2]float64{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+		rp.Body = [3]float64{1, c[0] * th, c[1] * tv}
+		if f.Corners[i], err = Trace(ctx, rp); err != nil && !errors.Is(err, ErrUnknownTerrain) {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// FOV — итоговые углы обзора по горизонтали и вертикали, градусы.
+func (p FootprintParams) FOV() (h, v float64, err error) {
+	h, v = p.HFOV, p.VFOV
+	aspect := 0.0
+	if p.Width > 0 && p.Height > 0 {
+		aspect = float64(p.Height) / float64(p.Width)
+	}
+	switch {
+	case h > 0 && v > 0:
+	case h > 0 && aspect > 0:
+		v = 2 * math.Atan(math.Tan(h*math.Pi/360)*aspect) * 180 / math.Pi
+	case v > 0 && aspect > 0:
+		h = 2 * math.Atan(math.Tan(v*math.Pi/360)/aspect) * 180 / math.Pi
+	default:
+		return 0, 0, fmt.Errorf("footprint: need hfov and vfov, or one of them with image size")
+	}
+	if h >= 180 || v >= 180 {
+		return 0, 0, fmt.Errorf("footprint: fov must be < 180°")
+	}
+	return h, v, nil
+}
@@ -0,0 +1,171 @@
+package terrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Коэффициенты рефракции k: по умолчанию — для радиотрасс (эффективный
+// радиус 4/3 радиуса Земли, k=0.25), для оптической видимости — 0.13.
+const (
+	DefaultRefraction = 0.25
+	OpticalRefraction = 0.13
+)
+
+// MaxLOSSamples ограничивает число точек трассы (длина/шаг).
+const MaxLOSSamples = 200000
+
+// MaxTraceSteps ограничивает число шагов проверки перекрытия в GroundToPixel.
+const MaxTraceSteps = 1000000
+
+// ErrTooManySamples — трасса слишком длинная для заданного шага.
+var ErrTooManySamples = errors.New("terrain: too many samples")
+
+type LOSParams struct {
+	FromLat, FromLon, FromAlt float64 // высоты по MSL, как и DEM
+	ToLat, ToLon, ToAlt       float64
+	DEM                       ElevationSource
+	Step                      float64 // шаг по поверхности, м
+
+	Curvature  bool    // учитывать кривизну Земли
+	Refraction float64 // коэффициент рефракции k, только вместе с Curvature
+}
+
+type LOSResult struct {
+	Visible  bool
+	Distance float64 // длина трассы по поверхности, м
+
+	// Минимальный запас над рельефом вдоль трассы (<0 — рельеф выше луча)
+	Clearance                  float64
+	ClearanceLat, ClearanceLon float64
+	ClearanceDist              float64
+
+	// Первая точка перекрытия, заполнена только при Visible == false
+	BlockLat, BlockLon float64
+	BlockDist          float64
+	BlockGround        float64 // высота рельефа (с поправкой на кривизну)
+	BlockAlt           float64 // высота луча в этой точке
+}
+
+// EffectiveRadius — радиус Земли с поправкой на рефракцию, R/(1-k).
+// k ≥ 1 — плоская Земля или сверхрефракция, такие значения не принимаются.
+func EffectiveRadius(k float64) (float64, error) {
+	if !(k >= 0 && k < 1) {
+		return 0, fmt.Errorf("terrain: refraction k=%g outside [0, 1)", k)
+	}
+	return RadiusOfEarth / (1 - k), nil
+}
+
+// Distance — расстояние по большому кругу (haversine), м
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	la1, la2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dla := la2 - la1
+	dlo := (lon2 - lon1) * math.Pi / 180
+	h := math.Sin(dla/2)*math.Sin(dla/2) + math.Cos(la1)*math.Cos(la2)*math.Sin(dlo/2)*math.Sin(dlo/2)
+	return 2 * RadiusOfEarth * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Intermediate — точка на дуге большого круга, f в [0..1]
+func Intermediate(lat1, lon1, lat2, lon2, f float64) (lat, lon float64) {
+	d := Distance(lat1, lon1, lat2, lon2) / RadiusOfEarth
+	if d < 1e-12 {
+		return lat1, lon1
+	}
+	la1, lo1 := lat1*math.Pi/180, lon1*math.Pi/180
+	la2, lo2 := lat2*math.Pi/180, lon2*math.Pi/180
+	A := math.Sin((1-f)*d) / math.Sin(d)
+	B := math.Sin(f*d) / math.Sin(d)
+	x := A*math.Cos(la1)*math.Cos(lo1) + B*math.Cos(la2)*math.Cos(lo2)
+	y := A*math.Cos(la1)*math.Sin(lo1) + B*math.Cos(la2)*math.Sin(lo2)
+	z := A*math.Sin(la1) + B*math.Sin(la2)
+	return math.Atan2(z, math.Sqrt(x*x+y*y)) * 180 / math.Pi, math.Atan2(y, x) * 180 / math.Pi
+}
+
+// LineOfSight проверяет прямую видимость между двумя точками над рельефом.
+// Трасса проходится шагами как в Raycast, первое перекрытие уточняется бисекцией.
+// Концы трассы не проверяются: точка на земле не должна «закрывать» сама себя.
+// Точки берутся на дуге большого круга, поэтому трасса через антимеридиан
+// не уходит в обход Земли. Точка без данных рельефа прерывает проверку
+// с ErrUnknownTerrain, больше MaxLOSSamples точек — ErrTooManySamples.
+func LineOfSight(ctx context.Context, p LOSParams) (LOSResult, error) {
+	if p.DEM == nil {
+		return LOSResult{}, fmt.Errorf("los: DEM required")
+	}
+	if p.Step <= 0 {
+		p.Step = 10
+	}
+	res := LOSResult{Visible: true, Clearance: math.Inf(1)}
+	total := Distance(p.FromLat, p.FromLon, p.ToLat, p.ToLon)
+	res.Distance = total
+	if total/p.Step > MaxLOSSamples {
+		return res, fmt.Errorf("%w: %.0f m with step %g m (max %d)", ErrTooManySamples, total, p.Step, MaxLOSSamples)
+	}
+
+	// эффективный радиус с учётом рефракции
+	re := RadiusOfEarth
+	if p.Curvature {
+		var err error
+		if re, err = EffectiveRadius(p.Refraction); err != nil {
+			return res, err
+		}
+	}
+
+	// запас над рельефом в точке f ∈ [0..1] вдоль трассы
+	clearance := func(f float64) (lat, lon, ground, alt, c float64, err error) {
+		lat, lon = Intermediate(p.FromLat, p.FromLon, p.ToLat, p.ToLon, f)
+		alt = p.FromAlt + f*(p.ToAlt-p.FromAlt)
+		if ground, err = sample(ctx, p.DEM, lat, lon); err != nil {
+			return
+		}
+		if p.Curvature {
+			d1 := f * total
+			ground += d1 * (total - d1) / (2 * re)
+		}
+		return lat, lon, ground, alt, alt - ground, nil
+	}
+
+	n := int(math.Ceil(total / p.Step))
+	if n < 2 {
+		n = 2
+	}
+	prevF := 0.0
+	for i := 1; i < n; i++ {
+		f := float64(i) / float64(n)
+		lat, lon, ground, alt, c, err := clearance(f)
+		if err != nil {
+			return res, err
+		}
+		if c < res.Clearance {
+			res.Clearance = c
+			res.ClearanceLat, res.ClearanceLon, res.ClearanceDist = lat, lon, f*total
+		}
+		if c <= 0 && res.Visible {
+			// уточняем первую точку перекрытия между prevF и f
+			lo, hi := prevF, f
+			for k := 0; k < 20; k++ {
+				mid := 0.5 * (lo + hi)
+				_, _, _, _, cm, err := clearance(mid)
+				if err != nil {
+					return res, err
+				}
+				if cm > 0 {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			if hi != f {
+				if lat, lon, ground, alt, _, err = clearance(hi); err != nil {
+					return res, err
+				}
+			}
+			res.Visible = false
+			res.BlockLat, res.BlockLon, res.BlockDist = lat, lon, hi*total
+			res.BlockGround, res.BlockAlt = ground, alt
+		}
+		prevF = f
+	}
+	return res, nil
+}
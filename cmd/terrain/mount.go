@@ -0,0 +1,63 @@
+package terrain
+
+import "math"
+
+// Mount — установка камеры на борту. Итоговая ориентация камеры в NED:
+//
+//	q_cam = q_vehicle ⊗ q_offset ⊗ q_gimbal
+//
+// либо q_gimbal напрямую, если подвес отдаёт углы относительно горизонта (EarthFrame).
+type Mount struct {
+	Gimbal      [4]float64 // кватернион подвеса w,x,y,z; нулевой — берутся GimbalEuler
+	GimbalEuler [3]float64 // roll, pitch, yaw подвеса, градусы
+	EarthFrame  bool       // углы/кватернион подвеса заданы в NED, а не относительно корпуса
+
+	Offset   [3]float64 // монтажный разворот крепления подвеса к корпусу: roll, pitch, yaw, градусы
+	LeverArm [3]float64 // смещение камеры от антенны GPS в связанной СК FRD, м
+}
+
+func (m Mount) gimbalQuat() [4]float64 {
+	if quatNorm(m.Gimbal) > 1e-9 {
+		return m.Gimbal
+	}
+	return eulerDegToQuat(m.GimbalEuler)
+}
+
+// Attitude — ориентация камеры в NED по ориентации корпуса.
+func (m Mount) Attitude(vehicle [4]float64) [4]float64 {
+	g := m.gimbalQuat()
+	if m.EarthFrame {
+		return g
+	}
+	if m.Offset != [3]float64{} {
+		g = QuatMul(eulerDegToQuat(m.Offset), g)
+	}
+	return QuatMul(vehicle, g)
+}
+
+func eulerDegToQuat(e [3]float64) [4]float64 {
+	if e == [3]float64{} {
+		return [4]float64{1, 0, 0, 0}
+	}
+	d := math.Pi / 180
+	return EulerToQuat(e[0]*d, e[1]*d, e[2]*d)
+}
+
+// CameraAttitude — ориентация камеры с учётом подвеса и монтажа.
+func (p RaycastParams) CameraAttitude() [4]float64 {
+	return p.Mount.Attitude(p.Quat)
+}
+
+// CameraPosition — положение камеры: антенна + плечо, повёрнутое ориентацией корпуса.
+// Высота, как и CamAlt, по эллипсоиду.
+func (p RaycastParams) CameraPosition() (lat, lon, alt float64) {
+	lat, lon, alt = p.CamLat, p.CamLon, p.CamAlt
+	if p.Mount.LeverArm == [3]float64{} {
+		return
+	}
+	ned := QuaternionRotate(p.Quat, p.Mount.LeverArm)
+	lat += (ned[0] / RadiusOfEarth) * (180 / math.Pi)
+	lon += (ned[1] / (RadiusOfEarth * math.Cos(p.CamLat*math.Pi/180))) * (180 / math.Pi)
+	alt -= ned[2]
+	return
+}
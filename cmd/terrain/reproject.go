@@ -0,0 +1,91 @@
+package terrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+type GroundToPixelParams struct {
+	RaycastParams // поза камеры и подвес; Step/MaxDist — для проверки перекрытия
+	Camera        Intrinsics
+	Width, Height int     // размер кадра; 0 — границы кадра не проверяются
+	MaxRange      float64 // дальше перекрытие не проверяется (Unknown); 0 — без ограничения
+
+	Lat, Lon float64 // точка на земле, высота берётся из DEM
+}
+
+type PixelResult struct {
+	U, V     float64
+	Ground   float64 // высота точки (MSL)
+	Range    float64 // наклонная дальность от камеры, м
+	InFront  bool    // точка перед камерой
+	InFrame  bool    // попадает в кадр
+	Occluded bool    // луч упирается в рельеф раньше точки
+	Unknown  bool    // перекрытие не проверено: по лучу нет данных рельефа
+}
+
+func (r PixelResult) Visible() bool { return r.InFrame && !r.Occluded && !r.Unknown }
+
+// GroundToPixel — обратная к PixelToGround задача: где в кадре видна точка на земле.
+// Использует ту же плоскую локальную модель и ту же композицию кватернионов,
+// перекрытие проверяется трассировкой того же луча через Trace.
+func GroundToPixel(ctx context.Context, p GroundToPixelParams) (PixelResult, error) {
+	if err := p.Camera.Validate(); err != nil {
+		return PixelResult{}, err
+	}
+	if p.DEM == nil {
+		return PixelResult{}, fmt.Errorf("reproject: DEM required")
+	}
+	var res PixelResult
+	g, err := sample(ctx, p.DEM, p.Lat, p.Lon)
+	if err != nil {
+		return res, err
+	}
+	res.Ground = g
+
+	camLat, camLon, camAlt := p.CameraPosition()
+	camAlt = EllipsoidToMSL(camLat, camLon, camAlt)
+	ned := [3]float64{
+		(p.Lat - camLat) * math.Pi / 180 * RadiusOfEarth,
+		math.Remainder(p.Lon-camLon, 360) * math.Pi / 180 * RadiusOfEarth * math.Cos(camLat*math.Pi/180),
+		camAlt - res.Ground,
+	}
+	res.Range = math.Sqrt(ned[0]*ned[0] + ned[1]*ned[1] + ned[2]*ned[2])
+
+	body := QuaternionRotate(QuatConj(p.CameraAttitude()), ned)
+	if body[0] <= 1e-9 {
+		return res, nil
+	}
+	res.InFront = true
+	res.U, res.V = p.Camera.Distort(body[1]/body[0], body[2]/body[0])
+	res.InFrame = p.Width <= 0 || p.Height <= 0 ||
+		(res.U >= 0 && res.U < float64(p.Width) && res.V >= 0 && res.V < float64(p.Height))
+	if p.MaxRange > 0 && res.Range > p.MaxRange {
+		res.Unknown = true
+		return res, nil
+	}
+
+	// трассируем тот же луч чуть дальше точки: попадание заметно раньше — перекрытие
+	rp := p.RaycastParams
+	rp.Body = body
+	if rp.Step <= 0 {
+		rp.Step = 1
+	}
+	tol := math.Max(2*rp.Step, 0.01*res.Range)
+	rp.MaxDist = res.Range + tol
+	if rp.MaxDist/rp.Step > MaxTraceSteps {
+		return res, fmt.Errorf("%w: %.0f m with step %g m (max %d)", ErrTooManySamples, rp.MaxDist, rp.Step, MaxTraceSteps)
+	}
+	hit, err := Trace(ctx, rp)
+	switch {
+	case errors.Is(err, ErrUnknownTerrain):
+		res.Unknown = true
+	case err != nil:
+		return res, err
+	case hit.Hit && hit.Range < res.Range-tol:
+		res.Occluded = true
+	}
+	return res, nil
+}
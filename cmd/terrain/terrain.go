@@ -1,6 +1,9 @@
 package terrain
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 
 	"github.com/westphae/geomag/pkg/egm96"
@@ -10,30 +13,64 @@ import (
 
 const (
 	RadiusOfEarth = 6378137.0
+
+	ctxCheckEvery = 1024 // шагов трассировки между проверками отмены
+)
+
+var (
+	// ErrNoData — у источника нет высоты в точке (void, нет тайла). Источники
+	// оборачивают свои ошибки в неё, чтобы трассировка отличала «нет данных» от сбоя.
+	ErrNoData = errors.New("terrain: no elevation data")
+	// ErrUnknownTerrain — луч дошёл до точки без данных рельефа.
+	ErrUnknownTerrain = errors.New("terrain: unknown terrain")
 )
 
+// ElevationSource — высота рельефа по MSL. Вместо выдуманного 0 м источник
+// должен вернуть ошибку, оборачивающую ErrNoData.
 type ElevationSource interface {
-	Height(lat, lon float64) float64
+	Height(ctx context.Context, lat, lon float64) (float64, error)
+}
+
+// HeightFunc позволяет использовать обычную функцию как ElevationSource.
+type HeightFunc func(ctx context.Context, lat, lon float64) (float64, error)
+
+func (f HeightFunc) Height(ctx context.Context, lat, lon float64) (float64, error) {
+	return f(ctx, lat, lon)
+}
+
+// sample запрашивает высоту и превращает ErrNoData в ErrUnknownTerrain с координатами.
+func sample(ctx context.Context, dem ElevationSource, lat, lon float64) (float64, error) {
+	h, err := dem.Height(ctx, lat, lon)
+	if err == nil {
+		return h, nil
+	}
+	if errors.Is(err, ErrNoData) {
+		return 0, fmt.Errorf("%w at %.7f,%.7f: %w", ErrUnknownTerrain, lat, lon, err)
+	}
+	return 0, err
 }
 
 // ----------- Кватернион → вектор направления -----------------
 
 func QuaternionToForwardPX4(q [4]float64) [3]float64 {
-	w := q[0]
-	x := q[1]
-	y := q[2]
-	z := q[3]
+	if quatNorm(q) < 1e-9 {
+		return [3]float64{0, 0, -1}
+	}
+	return QuaternionRotate(q, [3]float64{1, 0, 0})
+}
 
-	n := math.Sqrt(w*w + x*x + y*y + z*z)
+// QuaternionRotate поворачивает вектор из связанной СК (FRD) в NED: v' = q·v·q*.
+func QuaternionRotate(q [4]float64, v [3]float64) [3]float64 {
+	n := quatNorm(q)
 	if n < 1e-9 {
-		return [3]float64{0, 0, -1}
+		return v
 	}
-	w /= n
-	x /= n
-	y /= n
-	z /= n
+	w := q[0] / n
+	x := q[1] / n
+	y := q[2] / n
+	z := q[3] / n
 
-	vx, vy, vz := 1.0, 0.0, 0.0
+	vx, vy, vz := v[0], v[1], v[2]
 
 	ix := w*vx + y*vz - z*vy
 	iy := w*vy + z*vx - x*vz
@@ -47,21 +84,48 @@ func QuaternionToForwardPX4(q [4]float64) [3]float64 {
 	return [3]float64{rx, ry, rz}
 }
 
+func quatNorm(q [4]float64) float64 {
+	return math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[2]*q[2] + q[3]*q[3])
+}
+
 // ----------- Основной алгоритм трассировки -----------------
 
 type RaycastParams struct {
 	CamLon, CamLat, CamAlt float64
 	Quat                   [4]float64
+	Body                   [3]float64 // направление луча в СК камеры; нулевой — ось X (вперёд)
+	Mount                  Mount      // подвес, монтаж и плечо камеры; нулевой — камера по оси корпуса
 	DEM                    ElevationSource
 	Step, MaxDist          float64
 }
 
+// RaycastResult — подробный результат трассировки.
+type RaycastResult struct {
+	Lon, Lat float64
+	Alt      float64 // высота точки луча (MSL)
+	Ground   float64 // высота рельефа в точке (MSL)
+	Range    float64 // наклонная дальность от камеры, м
+	Hit      bool
+	Unknown  bool // луч упёрся в точку без данных рельефа (Lon/Lat — где именно)
+}
+
 // Raycast возвращает точку пересечения луча камеры с землёй.
 // CamAlt задаётся по эллипсоиду (GPS), но переводится в MSL через EGM96.
 // DEM уже по MSL — сравнение выполняется в одной системе (MSL).
-func Raycast(p RaycastParams) (lon, lat, ground float64, hit bool) {
+func Raycast(ctx context.Context, p RaycastParams) (lon, lat, ground float64, hit bool, err error) {
+	r, err := Trace(ctx, p)
+	if !r.Hit {
+		return r.Lon, r.Lat, r.Alt, false, err
+	}
+	return r.Lon, r.Lat, r.Ground, true, err
+}
+
+// Trace — то же, что Raycast, но дополнительно отдаёт наклонную дальность.
+// Если по пути встречается точка без данных, трассировка прерывается:
+// результат с Unknown=true и ошибка, оборачивающая ErrUnknownTerrain.
+func Trace(ctx context.Context, p RaycastParams) (RaycastResult, error) {
 	if p.DEM == nil {
-		return 0, 0, 0, false
+		return RaycastResult{}, fmt.Errorf("raycast: DEM required")
 	}
 
 	if p.Step <= 0 {
@@ -72,44 +136,52 @@ func Raycast(p RaycastParams) (lon, lat, ground float64, hit bool) {
 	}
 
 	// направление из PX4 кватерниона
-	dir := QuaternionToForwardPX4(p.Quat)
+	dir := rayDirection(p)
 	dirN, dirE, dirD := dir[0], dir[1], dir[2]
 
-	curLat := p.CamLat
-	curLon := p.CamLon
+	curLat, curLon, ellAlt := p.CameraPosition()
 
 	// --- перевод высоты дрона (WGS84 эллипсоид) → MSL через EGM96 ---
-	ellAlt := p.CamAlt
-	loc := egm96.NewLocationGeodetic(curLat, curLon, ellAlt)
-	hMSL, err := loc.HeightAboveMSL()
-	if err != nil {
-		// fallback: если ошибка, оставляем как есть
-		hMSL = ellAlt
-	}
-	curAlt := hMSL // теперь в MSL
+	curAlt := EllipsoidToMSL(curLat, curLon, ellAlt)
 
 	dist := 0.0
-	prevLat, prevLon, prevAlt := curLat, curLon, curAlt
+	prevLat, prevLon, prevAlt, prevDist := curLat, curLon, curAlt, dist
 
-	for dist <= p.MaxDist && curLat <= 85 && curLat >= -85 {
-		g := p.DEM.Height(curLat, curLon) // MSL
+	for i := 0; dist <= p.MaxDist && curLat <= 85 && curLat >= -85; i++ {
+		// источник может не смотреть на ctx (попадания в кэш), проверяем сами
+		if i%ctxCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return RaycastResult{Lon: curLon, Lat: curLat, Alt: curAlt, Range: dist}, err
+			}
+		}
+		g, err := sample(ctx, p.DEM, curLat, curLon) // MSL
+		if err != nil {
+			return unknownAt(curLon, curLat, curAlt, dist, err)
+		}
 
 		if curAlt <= g {
-			// бинарный поиск для уточнения
+			// бинарный поиск для уточнения между предыдущим и текущим шагом
 			for i := 0; i < 20; i++ {
 				midLat := 0.5 * (prevLat + curLat)
 				midLon := 0.5 * (prevLon + curLon)
 				midAlt := 0.5 * (prevAlt + curAlt)
-				gm := p.DEM.Height(midLat, midLon)
+				midDist := 0.5 * (prevDist + dist)
+				gm, err := sample(ctx, p.DEM, midLat, midLon)
+				if err != nil {
+					return unknownAt(midLon, midLat, midAlt, midDist, err)
+				}
 				if midAlt > gm {
-					prevLat, prevLon, prevAlt = midLat, midLon, midAlt
+					prevLat, prevLon, prevAlt, prevDist = midLat, midLon, midAlt, midDist
 				} else {
-					curLat, curLon, curAlt = midLat, midLon, midAlt
+					curLat, curLon, curAlt, dist = midLat, midLon, midAlt, midDist
+					g = gm
 				}
 			}
-			return curLon, curLat, g, true
+			return RaycastResult{Lon: curLon, Lat: curLat, Alt: curAlt, Ground: g, Range: dist, Hit: true}, nil
 		}
 
+		prevLat, prevLon, prevAlt, prevDist = curLat, curLon, curAlt, dist
+
 		dist += p.Step
 		curAlt += -dirD * p.Step
 		dNorth := dirN * p.Step
@@ -124,12 +196,38 @@ func Raycast(p RaycastParams) (lon, lat, ground float64, hit bool) {
 		if curLon < -180 {
 			curLon += 360
 		}
+	}
 
-		prevLat, prevLon, prevAlt = curLat, curLon, curAlt
+	return RaycastResult{Lon: curLon, Lat: curLat, Alt: curAlt, Range: dist}, nil
+}
+
+func unknownAt(lon, lat, alt, dist float64, err error) (RaycastResult, error) {
+	r := RaycastResult{Lon: lon, Lat: lat, Alt: alt, Range: dist}
+	r.Unknown = errors.Is(err, ErrUnknownTerrain)
+	return r, err
+}
+
+func rayDirection(p RaycastParams) [3]float64 {
+	q := p.CameraAttitude()
+	b := p.Body
+	n := math.Sqrt(b[0]*b[0] + b[1]*b[1] + b[2]*b[2])
+	if n < 1e-12 {
+		return QuaternionToForwardPX4(q)
 	}
+	return QuaternionRotate(q, [3]float64{b[0] / n, b[1] / n, b[2] / n})
+}
 
-	return curLon, curLat, curAlt, false
+// EllipsoidToMSL переводит высоту GPS (эллипсоид WGS84) в MSL через EGM96.
+func EllipsoidToMSL(lat, lon, ellAlt float64) float64 {
+	loc := egm96.NewLocationGeodetic(lat, lon, ellAlt)
+	hMSL, err := loc.HeightAboveMSL()
+	if err != nil {
+		// fallback: если ошибка, оставляем как есть
+		return ellAlt
+	}
+	return hMSL
 }
+
 func MSLToEllipsoid(lat, lon, hMSL float64) (float64, float64, float64) {
 	loc, err := egm96.NewLocationMSL(lat, lon, hMSL)
 	if err != nil {
@@ -0,0 +1,333 @@
+package terrain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/westphae/geomag/pkg/egm96"
+)
+
+type flatDEM float64
+
+func (f flatDEM) Height(_ context.Context, _, _ float64) (float64, error) { return float64(f), nil }
+
+func TestQuaternionToForwardPX4(t *testing.T) {
+	// тангаж -45°: нос вниз
+	h := -math.Pi / 8
+	dir := QuaternionToForwardPX4([4]float64{math.Cos(h), 0, math.Sin(h), 0})
+	want := [3]float64{math.Sqrt2 / 2, 0, math.Sqrt2 / 2}
+	for i := range dir {
+		if math.Abs(dir[i]-want[i]) > 1e-9 {
+			t.Fatalf("dir=%v want %v", dir, want)
+		}
+	}
+}
+
+func TestTraceFlatGround(t *testing.T) {
+	const lat, lon, alt, ground = 25.0, 55.0, 300.0, 100.0
+	h := -math.Pi / 8
+	res, err := Trace(context.Background(), RaycastParams{
+		CamLat: lat, CamLon: lon, CamAlt: alt,
+		Quat:    [4]float64{math.Cos(h), 0, math.Sin(h), 0},
+		DEM:     flatDEM(ground),
+		Step:    5,
+		MaxDist: 2000,
+	})
+	if err != nil || !res.Hit {
+		t.Fatalf("expected hit, got %+v %v", res, err)
+	}
+	msl, err := egm96.NewLocationGeodetic(lat, lon, alt).HeightAboveMSL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := (msl - ground) * math.Sqrt2
+	if math.Abs(res.Range-want) > 0.01 {
+		t.Errorf("range=%.3f want %.3f", res.Range, want)
+	}
+	if math.Abs(res.Ground-ground) > 1e-9 {
+		t.Errorf("ground=%v", res.Ground)
+	}
+}
+
+// рельеф есть только южнее 25.001
+type voidDEM struct{}
+
+func (voidDEM) Height(_ context.Context, lat, _ float64) (float64, error) {
+	if lat > 25.001 {
+		return 0, ErrNoData
+	}
+	return 0, nil
+}
+
+func TestTraceUnknownTerrain(t *testing.T) {
+	res, err := Trace(context.Background(), RaycastParams{
+		CamLat: 25, CamLon: 55, CamAlt: 300,
+		Quat:    [4]float64{1, 0, 0, 0}, // горизонтально на север
+		DEM:     voidDEM{},
+		MaxDist: 1000,
+	})
+	if !errors.Is(err, ErrUnknownTerrain) || !errors.Is(err, ErrNoData) {
+		t.Fatalf("err=%v", err)
+	}
+	if res.Hit || !res.Unknown || res.Lat < 25.001 || res.Range > 200 {
+		t.Errorf("result: %+v", res)
+	}
+}
+
+func TestTraceMiss(t *testing.T) {
+	res, err := Trace(context.Background(), RaycastParams{
+		CamLat: 25, CamLon: 55, CamAlt: 300,
+		Quat:    [4]float64{1, 0, 0, 0}, // горизонтально
+		DEM:     flatDEM(0),
+		MaxDist: 100,
+	})
+	if err != nil || res.Hit {
+		t.Fatalf("unexpected hit: %+v %v", res, err)
+	}
+}
+
+func TestTraceCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	_, err := Trace(ctx, RaycastParams{
+		CamLat: 25, CamLon: 55, CamAlt: 300,
+		Quat:    [4]float64{1, 0, 0, 0},
+		DEM:     flatDEM(0), // на ctx не смотрит
+		Step:    0.01,
+		MaxDist: 50000,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+// хребет высотой 200 м посередине трассы вдоль меридиана
+type ridgeDEM struct{ lat, h float64 }
+
+func (r ridgeDEM) Height(_ context.Context, lat, _ float64) (float64, error) {
+	if math.Abs(lat-r.lat) < 0.001 {
+		return r.h, nil
+	}
+	return 0, nil
+}
+
+func TestLineOfSight(t *testing.T) {
+	dem := ridgeDEM{lat: 25.05, h: 200}
+	p := LOSParams{
+		FromLat: 25, FromLon: 55, FromAlt: 100,
+		ToLat: 25.1, ToLon: 55, ToAlt: 100,
+		DEM:  dem,
+		Step: 20,
+	}
+	res, err := LineOfSight(context.Background(), p)
+	if err != nil || res.Visible {
+		t.Fatalf("expected blocked: %+v", res)
+	}
+	if math.Abs(res.BlockLat-(25.05-0.001)) > 1e-4 {
+		t.Errorf("block lat=%.6f", res.BlockLat)
+	}
+	if res.Clearance > -99 {
+		t.Errorf("clearance=%.2f", res.Clearance)
+	}
+
+	p.FromAlt, p.ToAlt = 300, 300
+	if res, _ := LineOfSight(context.Background(), p); !res.Visible || math.Abs(res.Clearance-100) > 1e-6 {
+		t.Errorf("expected visible with 100 m margin: %+v", res)
+	}
+
+	// на ~11 км без рельефа кривизна «съедает» ~2 м в середине трассы
+	p.DEM = flatDEM(0)
+	p.FromAlt, p.ToAlt = 1, 1
+	p.Curvature = true
+	if res, _ := LineOfSight(context.Background(), p); res.Visible {
+		t.Errorf("expected curvature to block: %+v", res)
+	}
+
+	// k вне [0, 1) не подменяется полной кривизной
+	for _, k := range []float64{1, 1.5, -0.1} {
+		p.Refraction = k
+		if _, err := LineOfSight(context.Background(), p); err == nil {
+			t.Errorf("k=%g accepted", k)
+		}
+	}
+}
+
+// рельеф есть только у антимеридиана, остальная Земля — стена
+type dateLineDEM struct{}
+
+func (dateLineDEM) Height(_ context.Context, _, lon float64) (float64, error) {
+	if math.Abs(lon) > 179 {
+		return 0, nil
+	}
+	return 1e4, nil
+}
+
+func TestLineOfSightAntimeridianAndLimit(t *testing.T) {
+	p := LOSParams{
+		FromLat: 0, FromLon: 179.99, FromAlt: 100,
+		ToLat: 0, ToLon: -179.99, ToAlt: 100,
+		DEM:  dateLineDEM{},
+		Step: 50,
+	}
+	res, err := LineOfSight(context.Background(), p)
+	if err != nil || !res.Visible {
+		t.Fatalf("short path across the date line should be visible: %+v, %v", res, err)
+	}
+	if math.Abs(res.Distance-Distance(0, 179.99, 0, -179.99)) > 1e-9 || res.Distance > 3000 {
+		t.Errorf("distance=%.1f", res.Distance)
+	}
+	if math.Abs(res.ClearanceLon) < 179.99 {
+		t.Errorf("clearance point off the great circle: lon=%.6f", res.ClearanceLon)
+	}
+
+	p.Step = 1e-3
+	if _, err := LineOfSight(context.Background(), p); !errors.Is(err, ErrTooManySamples) {
+		t.Errorf("tiny step: err=%v", err)
+	}
+
+	// без источника высот видимость не гарантируется
+	p.Step, p.DEM = 50, nil
+	if res, err := LineOfSight(context.Background(), p); err == nil || res.Visible {
+		t.Errorf("nil DEM: %+v, err=%v", res, err)
+	}
+}
+
+func TestCameraFootprintNadir(t *testing.T) {
+	h := -math.Pi / 4 // тангаж -90°, камера в надир
+	fp, err := CameraFootprint(context.Background(), FootprintParams{
+		RaycastParams: RaycastParams{
+			CamLat: 25, CamLon: 55, CamAlt: 300,
+			Quat: [4]float64{math.Cos(h), 0, math.Sin(h), 0},
+			DEM:  flatDEM(0), Step: 2, MaxDist: 2000,
+		},
+		HFOV: 90, Width: 1000, Height: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fp.Complete() || !fp.Center.Hit || math.Abs(fp.VFOV-90) > 1e-9 {
+		t.Fatalf("footprint: %+v", fp)
+	}
+	tl, br := fp.Corners[0], fp.Corners[2]
+	if !(tl.Lat > fp.Center.Lat && tl.Lon < fp.Center.Lon) {
+		t.Errorf("TL should be north-west of center: %+v", tl)
+	}
+	if !(br.Lat < fp.Center.Lat && br.Lon > fp.Center.Lon) {
+		t.Errorf("BR should be south-east of center: %+v", br)
+	}
+	// угол на 45° от надира: дальность в √3 раз больше, чем до центра
+	if r := tl.Range / fp.Center.Range; math.Abs(r-math.Sqrt(3)) > 1e-3 {
+		t.Errorf("corner/center range ratio = %.4f", r)
+	}
+}
+
+func TestPixelToGroundGimbalNadir(t *testing.T) {
+	cam := Intrinsics{Fx: 1000, Fy: 1000, Cx: 960, Cy: 540}
+	base := RaycastParams{
+		CamLat: 25, CamLon: 55, CamAlt: 300,
+		Quat: [4]float64{1, 0, 0, 0},
+		DEM:  flatDEM(0), Step: 2, MaxDist: 2000,
+		Mount: Mount{GimbalEuler: [3]float64{0, -90, 0}},
+	}
+	res, err := PixelToGround(context.Background(), PixelRaycastParams{
+		RaycastParams: base, Camera: cam, U: 960, V: 540,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Hit || math.Abs(res.Lat-25) > 1e-7 || math.Abs(res.Lon-55) > 1e-7 {
+		t.Fatalf("principal point should hit nadir: %+v", res)
+	}
+
+	// пиксель правее центра при взгляде в надир уходит на восток
+	right, _ := PixelToGround(context.Background(), PixelRaycastParams{
+		RaycastParams: base, Camera: cam, U: 1960, V: 540,
+	})
+	if !right.Hit || right.Lon <= res.Lon {
+		t.Errorf("expected hit east of nadir: %+v", right)
+	}
+}
+
+func TestGroundToPixelRoundTrip(t *testing.T) {
+	cam := Intrinsics{Fx: 1200, Fy: 1180, Cx: 960, Cy: 540, K1: -0.1, K2: 0.02, P1: 0.001, P2: -0.0005}
+	base := RaycastParams{
+		CamLat: 25, CamLon: 55, CamAlt: 300,
+		Quat: EulerToQuat(0.05, -0.3, 1.2),
+		DEM:  flatDEM(50), Step: 1, MaxDist: 5000,
+		Mount: Mount{
+			GimbalEuler: [3]float64{0, -20, 5},
+			Offset:      [3]float64{0, 0, 180},
+			LeverArm:    [3]float64{0.2, 0, 0.1},
+		},
+	}
+	hit, err := PixelToGround(context.Background(), PixelRaycastParams{
+		RaycastParams: base, Camera: cam, U: 1500, V: 800,
+	})
+	if err != nil || !hit.Hit {
+		t.Fatalf("forward: %+v %v", hit, err)
+	}
+	px, err := GroundToPixel(context.Background(), GroundToPixelParams{
+		RaycastParams: base, Camera: cam,
+		Width: 1920, Height: 1080,
+		Lat: hit.Lat, Lon: hit.Lon,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !px.Visible() || math.Abs(px.U-1500) > 0.5 || math.Abs(px.V-800) > 0.5 {
+		t.Errorf("round trip: %+v", px)
+	}
+}
+
+func TestGroundToPixelLimits(t *testing.T) {
+	cam := Intrinsics{Fx: 1000, Fy: 1000, Cx: 500, Cy: 500}
+	// камера у антимеридиана смотрит на восток, цель за 180°
+	base := RaycastParams{
+		CamLat: 0, CamLon: 179.999, CamAlt: 300,
+		Quat: EulerToQuat(0, -0.2, math.Pi/2),
+		DEM:  flatDEM(0), Step: 1,
+	}
+	px, err := GroundToPixel(context.Background(), GroundToPixelParams{
+		RaycastParams: base, Camera: cam, Lat: 0, Lon: -179.999,
+	})
+	if err != nil || px.Range > 1000 || !px.InFront {
+		t.Errorf("antimeridian: %+v %v", px, err)
+	}
+
+	far := GroundToPixelParams{RaycastParams: base, Camera: cam, Lat: 0, Lon: -179, MaxRange: 50000}
+	if px, err = GroundToPixel(context.Background(), far); err != nil || !px.Unknown {
+		t.Errorf("beyond max range: %+v %v", px, err)
+	}
+	far.MaxRange = 0
+	far.Step = 0.001
+	if _, err = GroundToPixel(context.Background(), far); !errors.Is(err, ErrTooManySamples) {
+		t.Errorf("tiny step: err=%v", err)
+	}
+}
+
+func TestMountAttitude(t *testing.T) {
+	// подвес смотрит в надир относительно горизонта — ориентация корпуса не важна
+	m := Mount{GimbalEuler: [3]float64{0, -90, 0}, EarthFrame: true}
+	dir := QuaternionToForwardPX4(m.Attitude(EulerToQuat(0.3, 0.2, 1.0)))
+	if math.Abs(dir[2]-1) > 1e-9 {
+		t.Errorf("earth-frame nadir: dir=%v", dir)
+	}
+
+	// камера смонтирована назад (yaw 180°), корпус смотрит на север → луч на юг
+	m = Mount{Offset: [3]float64{0, 0, 180}}
+	dir = QuaternionToForwardPX4(m.Attitude([4]float64{1, 0, 0, 0}))
+	if math.Abs(dir[0]+1) > 1e-9 {
+		t.Errorf("rear mount: dir=%v", dir)
+	}
+
+	// плечо 1 м вниз по корпусу с тангажом 0 опускает камеру на 1 м
+	p := RaycastParams{CamLat: 25, CamLon: 55, CamAlt: 100, Quat: [4]float64{1, 0, 0, 0},
+		Mount: Mount{LeverArm: [3]float64{0, 0, 1}}}
+	if _, _, alt := p.CameraPosition(); math.Abs(alt-99) > 1e-9 {
+		t.Errorf("lever arm alt=%v", alt)
+	}
+}